@@ -0,0 +1,354 @@
+package account
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"social-network/app/auth"
+	"social-network/app/mailer"
+	"social-network/app/sessions"
+	"time"
+)
+
+// DeletionGracePeriod is how long a user can change their mind before their account is purged
+const DeletionGracePeriod = 14 * 24 * time.Hour
+
+// RequestDeletionHandler schedules the logged-in user's account for deletion after the grace period.
+// The user must confirm their password (and 2FA code when enabled) and is emailed a confirmation.
+// Accounts without a password are first emailed a link whose token confirms the request instead.
+func RequestDeletionHandler(db *sql.DB, m mailer.Mailer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		user, ok := sessions.UserFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var request struct {
+			Password          string `json:"password"`
+			ConfirmationToken string `json:"confirmation_token,omitempty"` // For accounts without a password
+			Code              string `json:"code,omitempty"`
+			RecoveryCode      string `json:"recovery_code,omitempty"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		// Moderation actions are an audit log and must keep pointing at the moderator who took them
+		if user.Role != "user" {
+			http.Error(w, "Moderators and admins must give up their role before deleting their account", http.StatusConflict)
+			return
+		}
+
+		// Accounts without a password cannot re-enter one, so they confirm through their email first
+		hasPassword, err := auth.HasPassword(db, user.ID)
+		if err != nil {
+			http.Error(w, "Failed to fetch user", http.StatusInternalServerError)
+			return
+		}
+		if !hasPassword && request.ConfirmationToken == "" {
+			if err := auth.SendConfirmationEmail(db, m, user.ID, "delete your account", "/confirm-deletion"); err != nil {
+				log.Printf("Error sending deletion confirmation email: %v", err)
+				http.Error(w, "Failed to send confirmation email", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"message":               "Check your email to confirm the deletion",
+				"confirmation_required": true,
+			})
+			return
+		}
+
+		if !auth.ConfirmIdentity(w, db, user.ID, request.Password, request.ConfirmationToken, request.Code, request.RecoveryCode) {
+			return
+		}
+
+		var email, scheduledAt string
+		err = db.QueryRow(`
+			UPDATE users SET deletion_scheduled_at = COALESCE(deletion_scheduled_at, datetime('now', ?))
+			WHERE id = ?
+			RETURNING email, deletion_scheduled_at
+		`, fmt.Sprintf("+%d seconds", int64(DeletionGracePeriod.Seconds())), user.ID).Scan(&email, &scheduledAt)
+		if err != nil {
+			http.Error(w, "Failed to schedule account deletion", http.StatusInternalServerError)
+			return
+		}
+
+		body := fmt.Sprintf("Your account is scheduled to be permanently deleted on %s UTC.\n\n"+
+			"If you change your mind, sign in and cancel the deletion before then.\n"+
+			"If you did not request this, sign in, cancel the deletion and change your password.", scheduledAt)
+		if err := m.Send(email, "Your account will be deleted", body); err != nil {
+			log.Printf("Error sending account deletion email: %v", err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message":               "Account scheduled for deletion",
+			"deletion_scheduled_at": scheduledAt,
+		})
+	}
+}
+
+// CancelDeletionHandler cancels a pending deletion of the logged-in user's account
+func CancelDeletionHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		result, err := db.Exec(`UPDATE users SET deletion_scheduled_at = NULL WHERE id = ? AND deletion_scheduled_at IS NOT NULL`, userID)
+		if err != nil {
+			http.Error(w, "Failed to cancel account deletion", http.StatusInternalServerError)
+			return
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			http.Error(w, "No account deletion is pending", http.StatusNotFound)
+			return
+		}
+
+		w.Write([]byte("Account deletion cancelled successfully"))
+	}
+}
+
+// GetDeletionStatusHandler reports whether the logged-in user's account is scheduled for deletion
+func GetDeletionStatusHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var scheduledAt sql.NullString
+		if err := db.QueryRow(`SELECT deletion_scheduled_at FROM users WHERE id = ?`, userID).Scan(&scheduledAt); err != nil {
+			http.Error(w, "Failed to fetch account status", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"deletion_pending":      scheduledAt.Valid,
+			"deletion_scheduled_at": scheduledAt.String,
+		})
+	}
+}
+
+// deletionSteps remove everything that belongs to or points at the user (?1), in dependency order.
+// Groups the user created are deleted with all their content, as DeleteGroupHandler does.
+var deletionSteps = []string{
+	// Mentions and hashtags in content that goes away below, and mentions by or of the user
+	`DELETE FROM mentions WHERE author_id = ?1 OR mentioned_user_id = ?1
+	    OR (content_type = 'comment' AND content_id IN (SELECT id FROM comments WHERE post_id IN (SELECT id FROM posts WHERE user_id = ?1)))
+	    OR (content_type = 'group_post' AND content_id IN (SELECT id FROM group_posts WHERE group_id IN (SELECT id FROM groups WHERE creator_id = ?1)))
+	    OR (content_type = 'group_post_comment' AND content_id IN (SELECT id FROM group_post_comments WHERE post_id IN
+	        (SELECT id FROM group_posts WHERE user_id = ?1 OR group_id IN (SELECT id FROM groups WHERE creator_id = ?1))))
+	    OR (content_type = 'group_chat_message' AND content_id IN (SELECT id FROM group_chat_messages WHERE group_id IN (SELECT id FROM groups WHERE creator_id = ?1)))`,
+	`DELETE FROM hashtags WHERE (content_type = 'post' AND content_id IN (SELECT id FROM posts WHERE user_id = ?1))
+	    OR (content_type = 'group_post' AND content_id IN
+	        (SELECT id FROM group_posts WHERE user_id = ?1 OR group_id IN (SELECT id FROM groups WHERE creator_id = ?1)))`,
+
+	// Groups created by the user
+	`DELETE FROM group_post_comments WHERE post_id IN (SELECT id FROM group_posts WHERE group_id IN (SELECT id FROM groups WHERE creator_id = ?1))`,
+	`DELETE FROM group_posts WHERE group_id IN (SELECT id FROM groups WHERE creator_id = ?1)`,
+	`DELETE FROM group_chat_messages WHERE group_id IN (SELECT id FROM groups WHERE creator_id = ?1)`,
+	`DELETE FROM event_rsvp WHERE event_id IN (SELECT id FROM events WHERE group_id IN (SELECT id FROM groups WHERE creator_id = ?1))`,
+	`DELETE FROM notifications WHERE group_id IN (SELECT id FROM groups WHERE creator_id = ?1)
+	    OR event_id IN (SELECT id FROM events WHERE group_id IN (SELECT id FROM groups WHERE creator_id = ?1))`,
+	`DELETE FROM events WHERE group_id IN (SELECT id FROM groups WHERE creator_id = ?1)`,
+	`DELETE FROM group_membership WHERE group_id IN (SELECT id FROM groups WHERE creator_id = ?1)`,
+	`DELETE FROM groups WHERE creator_id = ?1`,
+
+	// The user's activity in other groups
+	`DELETE FROM group_post_comments WHERE user_id = ?1 OR post_id IN (SELECT id FROM group_posts WHERE user_id = ?1)`,
+	`DELETE FROM group_posts WHERE user_id = ?1`,
+	`DELETE FROM group_chat_messages WHERE sender_id = ?1`,
+	`DELETE FROM event_rsvp WHERE user_id = ?1`,
+	`DELETE FROM group_membership WHERE user_id = ?1`,
+
+	// Posts, comments and likes, including other users' comments and likes on the user's posts
+	`DELETE FROM likes WHERE user_id = ?1 OR post_id IN (SELECT id FROM posts WHERE user_id = ?1)`,
+	`DELETE FROM comments WHERE user_id = ?1 OR post_id IN (SELECT id FROM posts WHERE user_id = ?1)`,
+	`DELETE FROM post_privacy WHERE user_id = ?1 OR post_id IN (SELECT id FROM posts WHERE user_id = ?1)`,
+	`DELETE FROM post_audiences WHERE post_id IN (SELECT id FROM posts WHERE user_id = ?1)
+	    OR audience_id IN (SELECT id FROM audiences WHERE owner_id = ?1)`,
+	`DELETE FROM audience_members WHERE user_id = ?1 OR audience_id IN (SELECT id FROM audiences WHERE owner_id = ?1)`,
+	`DELETE FROM audiences WHERE owner_id = ?1`,
+	`DELETE FROM notifications WHERE user_id = ?1 OR related_user_id = ?1 OR post_id IN (SELECT id FROM posts WHERE user_id = ?1)`,
+	`DELETE FROM posts WHERE user_id = ?1`,
+
+	// Relationships and chat
+	`DELETE FROM followers WHERE follower_id = ?1 OR followed_id = ?1`,
+	`DELETE FROM blocks WHERE blocker_id = ?1 OR blocked_id = ?1`,
+	`DELETE FROM muted_users WHERE user_id = ?1 OR muted_user_id = ?1`,
+	`DELETE FROM muted_keywords WHERE user_id = ?1`,
+	`DELETE FROM private_chat_messages WHERE sender_id = ?1 OR receiver_id = ?1`,
+	`DELETE FROM user_status WHERE user_id = ?1`,
+	`DELETE FROM profile_links WHERE user_id = ?1`,
+	`DELETE FROM nickname_history WHERE user_id = ?1`,
+
+	// Moderation records about the user; actions taken by staff are kept, including those a former
+	// moderator took, without the user's ID
+	`DELETE FROM reports WHERE reporter_id = ?1 OR reported_user_id = ?1`,
+	`UPDATE reports SET resolved_by = NULL WHERE resolved_by = ?1`,
+	`UPDATE moderation_actions SET target_user_id = NULL WHERE target_user_id = ?1`,
+	`UPDATE moderation_actions SET moderator_id = NULL WHERE moderator_id = ?1`,
+
+	// Credentials
+	`DELETE FROM active_sessions WHERE user_id = ?1`,
+	`DELETE FROM api_tokens WHERE user_id = ?1`,
+	`DELETE FROM auth_tokens WHERE user_id = ?1`,
+	`DELETE FROM recovery_codes WHERE user_id = ?1`,
+	`DELETE FROM login_challenges WHERE user_id = ?1`,
+	`DELETE FROM oauth_identities WHERE user_id = ?1`,
+	`DELETE FROM oauth_states WHERE link_user_id = ?1`,
+
+	`DELETE FROM users WHERE id = ?1`,
+}
+
+// deletedMediaQuery lists every uploaded file that goes away with the user's account, including
+// images on other users' comments under the user's posts and on posts in groups the user created
+const deletedMediaQuery = `
+	SELECT 'avatars', avatar FROM users WHERE id = ?1
+	UNION ALL SELECT 'uploads', cover_image FROM users WHERE id = ?1
+	UNION ALL SELECT 'uploads', image_url FROM posts WHERE user_id = ?1
+	UNION ALL SELECT 'uploads', image_url FROM comments WHERE user_id = ?1 OR post_id IN (SELECT id FROM posts WHERE user_id = ?1)
+	UNION ALL SELECT 'uploads', image_url FROM group_posts WHERE user_id = ?1 OR group_id IN (SELECT id FROM groups WHERE creator_id = ?1)
+`
+
+// mediaFile is an uploaded file, stored by name under its directory
+type mediaFile struct {
+	Dir  string
+	Name string
+}
+
+// queryMedia returns the uploaded files listed by a media query for the user
+func queryMedia(db *sql.DB, query, userID string) ([]mediaFile, error) {
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []mediaFile
+	for rows.Next() {
+		var file mediaFile
+		var name sql.NullString
+		if err := rows.Scan(&file.Dir, &name); err != nil {
+			return nil, err
+		}
+		// Stored values are bare file names; Base guards against anything else escaping the directory
+		if name.String == "" || filepath.Base(name.String) != name.String {
+			continue
+		}
+		file.Name = name.String
+		files = append(files, file)
+	}
+	return files, rows.Err()
+}
+
+// DeleteAccount permanently deletes a user, every row that references them and their uploaded files
+func DeleteAccount(db *sql.DB, userID string) error {
+	files, err := queryMedia(db, deletedMediaQuery, userID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, step := range deletionSteps {
+		if _, err := tx.Exec(step, userID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Files are removed once the rows are gone so a failed transaction never leaves dangling references
+	for _, file := range files {
+		if err := os.Remove(filepath.Join(file.Dir, file.Name)); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error removing %s/%s: %v", file.Dir, file.Name, err)
+		}
+	}
+	return nil
+}
+
+// PurgeDeletedAccounts deletes every account whose grace period has ended. An account that cannot
+// be deleted is logged and skipped so it does not hold up the others; the errors are returned joined.
+func PurgeDeletedAccounts(db *sql.DB) (int, error) {
+	rows, err := db.Query(`
+		SELECT id FROM users
+		WHERE deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= CURRENT_TIMESTAMP AND role = 'user'
+	`)
+	if err != nil {
+		return 0, err
+	}
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	rows.Close()
+
+	purged := 0
+	var errs []error
+	for _, userID := range userIDs {
+		if err := DeleteAccount(db, userID); err != nil {
+			log.Printf("Error deleting account %s: %v", userID, err)
+			errs = append(errs, fmt.Errorf("deleting account %s: %w", userID, err))
+			continue
+		}
+		purged++
+	}
+	return purged, errors.Join(errs...)
+}
+
+// StartDeletionReaper purges accounts past their grace period in the background at the given interval
+func StartDeletionReaper(db *sql.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			purged, err := PurgeDeletedAccounts(db)
+			if err != nil {
+				log.Printf("Error purging deleted accounts: %v", err)
+			}
+			if purged > 0 {
+				log.Printf("Purged %d deleted accounts", purged)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,216 @@
+package account
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"social-network/app/sessions"
+	"time"
+)
+
+// exportSection is one JSON file of the data export and the query that fills it (?1 is the user ID)
+type exportSection struct {
+	File  string
+	Query string
+}
+
+var exportSections = []exportSection{
+	{"profile.json", `
+		SELECT id, email, first_name, last_name, nickname, about_me, avatar, date_of_birth,
+		       cover_image, location, pronouns, pinned_post_id, private, email_visibility, birthday_visibility, name_visibility, about_visibility,
+		       role, email_verified, totp_enabled, created_at
+		FROM users WHERE id = ?1`},
+	{"profile_links.json", `
+		SELECT label, url, position, created_at
+		FROM profile_links WHERE user_id = ?1 ORDER BY position`},
+	{"nickname_history.json", `
+		SELECT nickname, changed_at, reserved_until
+		FROM nickname_history WHERE user_id = ?1 ORDER BY changed_at`},
+	{"posts.json", `
+		SELECT id, content, image_url, privacy, likes_count, comments_count, created_at
+		FROM posts WHERE user_id = ?1 ORDER BY created_at`},
+	{"comments.json", `
+		SELECT id, post_id, content, image_url, created_at
+		FROM comments WHERE user_id = ?1 ORDER BY created_at`},
+	{"likes.json", `
+		SELECT post_id, created_at
+		FROM likes WHERE user_id = ?1 ORDER BY created_at`},
+	{"followers.json", `
+		SELECT u.id AS user_id, u.nickname, f.status, f.created_at
+		FROM followers f JOIN users u ON u.id = f.follower_id
+		WHERE f.followed_id = ?1 ORDER BY f.created_at`},
+	{"following.json", `
+		SELECT u.id AS user_id, u.nickname, f.status, f.created_at
+		FROM followers f JOIN users u ON u.id = f.followed_id
+		WHERE f.follower_id = ?1 ORDER BY f.created_at`},
+	{"groups.json", `
+		SELECT g.id, g.name, g.description, g.creator_id = ?1 AS is_creator, COALESCE(gm.status, 'member') AS status, g.created_at
+		FROM groups g LEFT JOIN group_membership gm ON gm.group_id = g.id AND gm.user_id = ?1
+		WHERE g.creator_id = ?1 OR gm.user_id = ?1 ORDER BY g.created_at`},
+	{"group_posts.json", `
+		SELECT id, group_id, content, image_url, created_at
+		FROM group_posts WHERE user_id = ?1 ORDER BY created_at`},
+	{"group_post_comments.json", `
+		SELECT id, post_id, content, created_at
+		FROM group_post_comments WHERE user_id = ?1 ORDER BY created_at`},
+	{"event_rsvps.json", `
+		SELECT e.id AS event_id, e.group_id, e.title, e.event_date, r.status, r.responded_at
+		FROM event_rsvp r JOIN events e ON e.id = r.event_id
+		WHERE r.user_id = ?1 ORDER BY r.responded_at`},
+	{"notifications.json", `
+		SELECT id, type, content, post_id, related_user_id, group_id, event_id, read, created_at
+		FROM notifications WHERE user_id = ?1 ORDER BY created_at`},
+	{"private_messages.json", `
+		SELECT id, sender_id, receiver_id, message, read, created_at
+		FROM private_chat_messages WHERE sender_id = ?1 OR receiver_id = ?1 ORDER BY created_at`},
+	{"group_messages.json", `
+		SELECT id, group_id, message, created_at
+		FROM group_chat_messages WHERE sender_id = ?1 ORDER BY created_at`},
+	{"mentions.json", `
+		SELECT content_type, content_id, mentioned_user_id, nickname, start_offset, length, created_at
+		FROM mentions WHERE author_id = ?1 ORDER BY created_at`},
+	{"blocks.json", `
+		SELECT blocked_id, created_at FROM blocks WHERE blocker_id = ?1 ORDER BY created_at`},
+	{"mutes.json", `
+		SELECT 'user' AS kind, muted_user_id AS value, created_at FROM muted_users WHERE user_id = ?1
+		UNION ALL SELECT 'keyword', keyword, created_at FROM muted_keywords WHERE user_id = ?1`},
+	{"audiences.json", `
+		SELECT a.id, a.name, am.user_id AS member_id, a.created_at
+		FROM audiences a LEFT JOIN audience_members am ON am.audience_id = a.id
+		WHERE a.owner_id = ?1 ORDER BY a.created_at`},
+	{"sessions.json", `
+		SELECT public_id, user_agent, ip_address, created_at, last_used_at, expires_at
+		FROM active_sessions WHERE user_id = ?1 ORDER BY created_at`},
+}
+
+// exportedMediaQuery lists the files the user uploaded themselves
+const exportedMediaQuery = `
+	SELECT 'avatars', avatar FROM users WHERE id = ?1
+	UNION ALL SELECT 'uploads', cover_image FROM users WHERE id = ?1
+	UNION ALL SELECT 'uploads', image_url FROM posts WHERE user_id = ?1
+	UNION ALL SELECT 'uploads', image_url FROM comments WHERE user_id = ?1
+	UNION ALL SELECT 'uploads', image_url FROM group_posts WHERE user_id = ?1
+`
+
+// queryRecords runs an export query and returns each row as a column name to value map
+func queryRecords(db *sql.DB, query, userID string) ([]map[string]interface{}, error) {
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	records := []map[string]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+
+		record := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			if b, ok := values[i].([]byte); ok {
+				record[column] = string(b)
+			} else {
+				record[column] = values[i]
+			}
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// ExportDataHandler streams a zip archive of everything the logged-in user has stored: one JSON file
+// per kind of data plus their avatar and uploaded images under media/
+func ExportDataHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		// Collect everything before writing so a database error can still be reported properly
+		sections := make(map[string][]map[string]interface{}, len(exportSections))
+		for _, section := range exportSections {
+			records, err := queryRecords(db, section.Query, userID)
+			if err != nil {
+				log.Printf("Error exporting %s: %v", section.File, err)
+				http.Error(w, "Failed to export data", http.StatusInternalServerError)
+				return
+			}
+			sections[section.File] = records
+		}
+		files, err := queryMedia(db, exportedMediaQuery, userID)
+		if err != nil {
+			http.Error(w, "Failed to export data", http.StatusInternalServerError)
+			return
+		}
+
+		fileName := fmt.Sprintf("social-network-export-%s.zip", time.Now().UTC().Format("2006-01-02"))
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+fileName+`"`)
+		w.Header().Set("Cache-Control", "no-store")
+
+		archive := zip.NewWriter(w)
+		defer archive.Close()
+
+		for _, section := range exportSections {
+			entry, err := archive.Create(section.File)
+			if err != nil {
+				log.Printf("Error writing export archive: %v", err)
+				return
+			}
+			encoder := json.NewEncoder(entry)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(sections[section.File]); err != nil {
+				log.Printf("Error writing export archive: %v", err)
+				return
+			}
+		}
+
+		for _, file := range files {
+			if err := addMediaFile(archive, file); err != nil {
+				log.Printf("Error adding %s/%s to export: %v", file.Dir, file.Name, err)
+			}
+		}
+	}
+}
+
+// addMediaFile copies an uploaded file into the archive under media/. Missing files are skipped.
+func addMediaFile(archive *zip.Writer, file mediaFile) error {
+	source, err := os.Open(filepath.Join(file.Dir, file.Name))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	entry, err := archive.Create("media/" + file.Dir + "/" + file.Name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, source)
+	return err
+}
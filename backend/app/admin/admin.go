@@ -0,0 +1,403 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"social-network/app/chat"
+	"social-network/app/moderation"
+	"social-network/app/sessions"
+	"strconv"
+)
+
+// AdminUser represents a user as listed in the admin API
+type AdminUser struct {
+	ID         string `json:"id"`
+	Email      string `json:"email"`
+	Nickname   string `json:"nickname"`
+	FirstName  string `json:"first_name"`
+	LastName   string `json:"last_name"`
+	Avatar     string `json:"avatar"`
+	Role       string `json:"role"`
+	Suspended  bool   `json:"suspended"`
+	Private    bool   `json:"private"`
+	CreatedAt  string `json:"created_at"`
+	Sessions   int    `json:"active_sessions"`
+	PostsCount int    `json:"posts_count"`
+}
+
+// SiteStats holds basic site-wide counters
+type SiteStats struct {
+	Users           int `json:"users"`
+	NewUsers7Days   int `json:"new_users_7_days"`
+	SuspendedUsers  int `json:"suspended_users"`
+	Moderators      int `json:"moderators"`
+	Admins          int `json:"admins"`
+	ActiveSessions  int `json:"active_sessions"`
+	Posts           int `json:"posts"`
+	Comments        int `json:"comments"`
+	Groups          int `json:"groups"`
+	GroupPosts      int `json:"group_posts"`
+	Events          int `json:"events"`
+	PrivateMessages int `json:"private_messages"`
+	GroupMessages   int `json:"group_messages"`
+	OpenReports     int `json:"open_reports"`
+}
+
+// ListUsersHandler lists users, optionally filtered by a nickname/email/name search, role or suspension
+func ListUsersHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		search := query.Get("query")
+		role := query.Get("role")
+		suspended := query.Get("suspended")
+		if suspended != "" && suspended != "true" && suspended != "false" {
+			http.Error(w, "Invalid suspended filter, must be 'true' or 'false'", http.StatusBadRequest)
+			return
+		}
+
+		limit, err := strconv.Atoi(query.Get("limit"))
+		if err != nil || limit <= 0 || limit > 100 {
+			limit = 20
+		}
+		page, err := strconv.Atoi(query.Get("page"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+
+		searchTerm := "%" + search + "%"
+		rows, err := db.Query(`
+			SELECT u.id, u.email, COALESCE(u.nickname, ''), u.first_name, u.last_name, COALESCE(u.avatar, ''),
+			       u.role, u.suspended, u.private, u.created_at,
+			       (SELECT COUNT(*) FROM active_sessions s WHERE s.user_id = u.id AND s.expires_at > CURRENT_TIMESTAMP),
+			       (SELECT COUNT(*) FROM posts p WHERE p.user_id = u.id)
+			FROM users u
+			WHERE (? = '' OR u.nickname LIKE ? OR u.email LIKE ? OR u.first_name LIKE ? OR u.last_name LIKE ?)
+			  AND (? = '' OR u.role = ?)
+			  AND (? = '' OR u.suspended = (? = 'true'))
+			ORDER BY u.created_at DESC
+			LIMIT ? OFFSET ?
+		`, search, searchTerm, searchTerm, searchTerm, searchTerm, role, role, suspended, suspended, limit, (page-1)*limit)
+		if err != nil {
+			log.Printf("Error listing users: %v", err)
+			http.Error(w, "Failed to fetch users", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		var users []AdminUser
+		for rows.Next() {
+			var user AdminUser
+			if err := rows.Scan(
+				&user.ID, &user.Email, &user.Nickname, &user.FirstName, &user.LastName, &user.Avatar,
+				&user.Role, &user.Suspended, &user.Private, &user.CreatedAt, &user.Sessions, &user.PostsCount,
+			); err != nil {
+				http.Error(w, "Failed to parse users", http.StatusInternalServerError)
+				return
+			}
+			users = append(users, user)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"users": users,
+			"page":  page,
+			"limit": limit,
+		})
+	}
+}
+
+// UpdateUserRoleHandler changes a user's global role (admin only)
+func UpdateUserRoleHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		adminID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var request struct {
+			UserID string `json:"user_id"`
+			Role   string `json:"role"` // "user", "moderator" or "admin"
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if request.Role != "user" && request.Role != "moderator" && request.Role != "admin" {
+			http.Error(w, "Invalid role, must be 'user', 'moderator' or 'admin'", http.StatusBadRequest)
+			return
+		}
+		if request.UserID == adminID {
+			http.Error(w, "You cannot change your own role", http.StatusBadRequest)
+			return
+		}
+
+		result, err := db.Exec(`UPDATE users SET role = ? WHERE id = ?`, request.Role, request.UserID)
+		if err != nil {
+			http.Error(w, "Failed to update role", http.StatusInternalServerError)
+			return
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			http.Error(w, "Failed to determine affected rows", http.StatusInternalServerError)
+			return
+		}
+		if rowsAffected == 0 {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		if err := moderation.LogAction(db, adminID, "set_role_"+request.Role, "user", request.UserID, request.UserID, "", ""); err != nil {
+			log.Printf("Failed to record moderation action: %v", err)
+		}
+
+		w.Write([]byte("Role updated successfully"))
+	}
+}
+
+// ForceLogoutHandler ends every active session of a user
+func ForceLogoutHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		staff, ok := sessions.UserFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		adminID := staff.ID
+
+		var request struct {
+			UserID string `json:"user_id"`
+			Note   string `json:"note,omitempty"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if request.UserID == "" {
+			http.Error(w, "Missing user_id", http.StatusBadRequest)
+			return
+		}
+
+		// Staff can only sign out users below their own role
+		outranks, err := moderation.Outranks(db, staff, request.UserID)
+		if err == moderation.ErrContentNotFound {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to check user role", http.StatusInternalServerError)
+			return
+		}
+		if !outranks {
+			http.Error(w, "Forbidden: you cannot act on users with an equal or higher role", http.StatusForbidden)
+			return
+		}
+
+		result, err := db.Exec(`DELETE FROM active_sessions WHERE user_id = ?`, request.UserID)
+		if err != nil {
+			http.Error(w, "Failed to purge sessions", http.StatusInternalServerError)
+			return
+		}
+		purged, _ := result.RowsAffected()
+
+		// Access and refresh tokens are signed out too
+		if err := sessions.RevokeTokenPairs(db, request.UserID); err != nil {
+			http.Error(w, "Failed to revoke tokens", http.StatusInternalServerError)
+			return
+		}
+
+		// Mark the user offline in persistent storage
+		if err := chat.MarkUserOffline(db, request.UserID); err != nil {
+			log.Printf("Failed to mark user offline: %v", err)
+		}
+
+		if err := moderation.LogAction(db, adminID, "force_logout", "user", request.UserID, request.UserID, "", request.Note); err != nil {
+			log.Printf("Failed to record moderation action: %v", err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":         "User logged out of all sessions",
+			"sessions_purged": purged,
+		})
+	}
+}
+
+// DeleteContentHandler permanently deletes a post, comment, group post or chat message on behalf of moderation
+func DeleteContentHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		adminID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var request struct {
+			ContentType string `json:"content_type"`
+			ContentID   string `json:"content_id"`
+			Note        string `json:"note,omitempty"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		ownerID, err := moderation.ContentOwner(db, request.ContentType, request.ContentID)
+		if err == moderation.ErrUnknownContentType || request.ContentType == "user" {
+			http.Error(w, "Invalid content_type", http.StatusBadRequest)
+			return
+		} else if err == moderation.ErrContentNotFound {
+			http.Error(w, "Content not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to look up content", http.StatusInternalServerError)
+			return
+		}
+
+		if err := deleteContent(db, request.ContentType, request.ContentID); err != nil {
+			log.Printf("Error deleting %s %s: %v", request.ContentType, request.ContentID, err)
+			http.Error(w, "Failed to delete content", http.StatusInternalServerError)
+			return
+		}
+
+		// Close any open reports against the deleted content
+		_, err = db.Exec(`
+			UPDATE reports SET status = 'actioned', resolved_by = ?, resolved_at = CURRENT_TIMESTAMP
+			WHERE content_type = ? AND content_id = ? AND status = 'open'
+		`, adminID, request.ContentType, request.ContentID)
+		if err != nil {
+			log.Printf("Failed to close reports for deleted content: %v", err)
+		}
+
+		if err := moderation.LogAction(db, adminID, "delete_content", request.ContentType, request.ContentID, ownerID, "", request.Note); err != nil {
+			log.Printf("Failed to record moderation action: %v", err)
+		}
+
+		w.Write([]byte("Content deleted successfully"))
+	}
+}
+
+// deleteContent removes a content row together with the rows that depend on it
+func deleteContent(db *sql.DB, contentType, contentID string) error {
+	var queries []string
+	switch contentType {
+	case "post":
+		queries = []string{
+			`DELETE FROM mentions WHERE (content_type = 'post' AND content_id = ?1)
+			    OR (content_type = 'comment' AND content_id IN (SELECT id FROM comments WHERE post_id = ?1))`,
+			`DELETE FROM hashtags WHERE content_type = 'post' AND content_id = ?`,
+			`DELETE FROM likes WHERE post_id = ?`,
+			`DELETE FROM comments WHERE post_id = ?`,
+			`DELETE FROM post_privacy WHERE post_id = ?`,
+			`DELETE FROM post_audiences WHERE post_id = ?`,
+			`DELETE FROM notifications WHERE post_id = ?`,
+			`DELETE FROM posts WHERE id = ?`,
+		}
+	case "comment":
+		queries = []string{
+			`DELETE FROM mentions WHERE content_type = 'comment' AND content_id = ?`,
+			`DELETE FROM comments WHERE id = ?`,
+		}
+	case "group_post":
+		queries = []string{
+			`DELETE FROM mentions WHERE (content_type = 'group_post' AND content_id = ?1)
+			    OR (content_type = 'group_post_comment' AND content_id IN (SELECT id FROM group_post_comments WHERE post_id = ?1))`,
+			`DELETE FROM hashtags WHERE content_type = 'group_post' AND content_id = ?`,
+			`DELETE FROM group_post_comments WHERE post_id = ?`,
+			`DELETE FROM group_posts WHERE id = ?`,
+		}
+	case "group_post_comment":
+		queries = []string{
+			`DELETE FROM mentions WHERE content_type = 'group_post_comment' AND content_id = ?`,
+			`DELETE FROM group_post_comments WHERE id = ?`,
+		}
+	case "group_chat_message":
+		queries = []string{
+			`DELETE FROM mentions WHERE content_type = 'group_chat_message' AND content_id = ?`,
+			`DELETE FROM group_chat_messages WHERE id = ?`,
+		}
+	case "private_chat_message":
+		queries = []string{
+			`DELETE FROM mentions WHERE content_type = 'private_chat_message' AND content_id = ?`,
+			`DELETE FROM private_chat_messages WHERE id = ?`,
+		}
+	default:
+		return moderation.ErrUnknownContentType
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, query := range queries {
+		if _, err := tx.Exec(query, contentID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetStatsHandler returns basic site statistics
+func GetStatsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var stats SiteStats
+		err := db.QueryRow(`
+			SELECT
+				(SELECT COUNT(*) FROM users),
+				(SELECT COUNT(*) FROM users WHERE created_at > datetime('now', '-7 days')),
+				(SELECT COUNT(*) FROM users WHERE suspended = 1),
+				(SELECT COUNT(*) FROM users WHERE role = 'moderator'),
+				(SELECT COUNT(*) FROM users WHERE role = 'admin'),
+				(SELECT COUNT(*) FROM active_sessions WHERE expires_at > CURRENT_TIMESTAMP),
+				(SELECT COUNT(*) FROM posts),
+				(SELECT COUNT(*) FROM comments),
+				(SELECT COUNT(*) FROM groups),
+				(SELECT COUNT(*) FROM group_posts),
+				(SELECT COUNT(*) FROM events),
+				(SELECT COUNT(*) FROM private_chat_messages),
+				(SELECT COUNT(*) FROM group_chat_messages),
+				(SELECT COUNT(*) FROM reports WHERE status = 'open')
+		`).Scan(
+			&stats.Users, &stats.NewUsers7Days, &stats.SuspendedUsers, &stats.Moderators, &stats.Admins,
+			&stats.ActiveSessions, &stats.Posts, &stats.Comments, &stats.Groups, &stats.GroupPosts,
+			&stats.Events, &stats.PrivateMessages, &stats.GroupMessages, &stats.OpenReports,
+		)
+		if err != nil {
+			log.Printf("Error fetching site stats: %v", err)
+			http.Error(w, "Failed to fetch site statistics", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(stats)
+	}
+}
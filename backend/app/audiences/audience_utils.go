@@ -0,0 +1,52 @@
+package audiences
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+)
+
+var (
+	errAudienceNotFound = errors.New("audience not found")
+	errNotAudienceOwner = errors.New("not the audience owner")
+)
+
+// checkAudienceOwner ensures the audience exists and belongs to the given user
+func checkAudienceOwner(db *sql.DB, audienceID, userID string) error {
+	var ownerID string
+	err := db.QueryRow(`SELECT owner_id FROM audiences WHERE id = ?`, audienceID).Scan(&ownerID)
+	if err == sql.ErrNoRows {
+		return errAudienceNotFound
+	} else if err != nil {
+		return err
+	}
+	if ownerID != userID {
+		return errNotAudienceOwner
+	}
+	return nil
+}
+
+// writeOwnerError maps a checkAudienceOwner error to an HTTP response
+func writeOwnerError(w http.ResponseWriter, err error) {
+	switch err {
+	case errAudienceNotFound:
+		http.Error(w, "Audience not found", http.StatusNotFound)
+	case errNotAudienceOwner:
+		http.Error(w, "Unauthorized: You can only manage your own audiences", http.StatusForbidden)
+	default:
+		http.Error(w, "Failed to check audience ownership", http.StatusInternalServerError)
+	}
+}
+
+// OwnsAudiences reports whether every given audience belongs to the user
+func OwnsAudiences(db *sql.DB, userID string, audienceIDs []string) (bool, error) {
+	for _, audienceID := range audienceIDs {
+		err := checkAudienceOwner(db, audienceID, userID)
+		if err == errAudienceNotFound || err == errNotAudienceOwner {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
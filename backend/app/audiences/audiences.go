@@ -0,0 +1,392 @@
+package audiences
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"social-network/app/sessions"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Audience represents a named, reusable list of users that private posts can be shared with
+type Audience struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	MembersCount int    `json:"members_count"`
+	CreatedAt    string `json:"created_at"`
+}
+
+// AudienceMember represents a user included in an audience list
+type AudienceMember struct {
+	ID       string `json:"id"`
+	Nickname string `json:"nickname"`
+	Avatar   string `json:"avatar"`
+}
+
+// CreateAudienceHandler creates a new audience list for the logged-in user
+func CreateAudienceHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var request struct {
+			Name    string   `json:"name"`
+			Members []string `json:"members,omitempty"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		name := strings.TrimSpace(request.Name)
+		if name == "" {
+			http.Error(w, "Audience name cannot be empty", http.StatusBadRequest)
+			return
+		}
+		if len(name) > 50 {
+			http.Error(w, "Audience name cannot exceed 50 characters", http.StatusBadRequest)
+			return
+		}
+
+		// Check for a duplicate name among the user's lists
+		var exists bool
+		err = db.QueryRow(`SELECT EXISTS(SELECT 1 FROM audiences WHERE owner_id = ? AND name = ?)`, userID, name).Scan(&exists)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if exists {
+			http.Error(w, "You already have an audience with this name", http.StatusConflict)
+			return
+		}
+
+		audienceID := uuid.New().String()
+
+		// Start a transaction so the list and its initial members are created together
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+			return
+		}
+
+		_, err = tx.Exec(`INSERT INTO audiences (id, owner_id, name) VALUES (?, ?, ?)`, audienceID, userID, name)
+		if err != nil {
+			tx.Rollback()
+			log.Printf("Error creating audience: %v", err)
+			http.Error(w, "Failed to create audience", http.StatusInternalServerError)
+			return
+		}
+
+		for _, memberID := range request.Members {
+			if memberID == userID {
+				continue
+			}
+			_, err = tx.Exec(`
+				INSERT INTO audience_members (audience_id, user_id)
+				SELECT ?, id FROM users WHERE id = ?
+				ON CONFLICT(audience_id, user_id) DO NOTHING
+			`, audienceID, memberID)
+			if err != nil {
+				tx.Rollback()
+				http.Error(w, "Failed to add audience members", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{
+			"message":     "Audience created successfully",
+			"audience_id": audienceID,
+			"name":        name,
+		})
+	}
+}
+
+// GetAudiencesHandler fetches the logged-in user's audience lists with member counts
+func GetAudiencesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		rows, err := db.Query(`
+			SELECT a.id, a.name, a.created_at,
+			       (SELECT COUNT(*) FROM audience_members am WHERE am.audience_id = a.id) AS members_count
+			FROM audiences a
+			WHERE a.owner_id = ?
+			ORDER BY a.created_at ASC
+		`, userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch audiences", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		var audiences []Audience
+		for rows.Next() {
+			var audience Audience
+			if err := rows.Scan(&audience.ID, &audience.Name, &audience.CreatedAt, &audience.MembersCount); err != nil {
+				http.Error(w, "Failed to parse audiences", http.StatusInternalServerError)
+				return
+			}
+			audiences = append(audiences, audience)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(audiences)
+	}
+}
+
+// DeleteAudienceHandler deletes one of the logged-in user's audience lists.
+// Private posts shared only with this list become visible to their author alone.
+func DeleteAudienceHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		audienceID := r.URL.Query().Get("id")
+		if audienceID == "" {
+			http.Error(w, "Missing audience ID", http.StatusBadRequest)
+			return
+		}
+
+		if err := checkAudienceOwner(db, audienceID, userID); err != nil {
+			writeOwnerError(w, err)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+			return
+		}
+
+		// Clean up memberships and post links before removing the list itself
+		for _, query := range []string{
+			`DELETE FROM post_audiences WHERE audience_id = ?`,
+			`DELETE FROM audience_members WHERE audience_id = ?`,
+			`DELETE FROM audiences WHERE id = ?`,
+		} {
+			if _, err := tx.Exec(query, audienceID); err != nil {
+				tx.Rollback()
+				http.Error(w, "Failed to delete audience", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
+		}
+
+		w.Write([]byte("Audience deleted successfully"))
+	}
+}
+
+// GetAudienceMembersHandler lists the members of one of the logged-in user's audience lists
+func GetAudienceMembersHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		audienceID := r.URL.Query().Get("audience_id")
+		if audienceID == "" {
+			http.Error(w, "Missing audience_id", http.StatusBadRequest)
+			return
+		}
+
+		if err := checkAudienceOwner(db, audienceID, userID); err != nil {
+			writeOwnerError(w, err)
+			return
+		}
+
+		rows, err := db.Query(`
+			SELECT users.id, users.nickname, users.avatar
+			FROM audience_members
+			JOIN users ON audience_members.user_id = users.id
+			WHERE audience_members.audience_id = ?
+			ORDER BY users.nickname ASC
+		`, audienceID)
+		if err != nil {
+			http.Error(w, "Failed to fetch audience members", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		var members []AudienceMember
+		for rows.Next() {
+			var member AudienceMember
+			if err := rows.Scan(&member.ID, &member.Nickname, &member.Avatar); err != nil {
+				http.Error(w, "Failed to parse audience members", http.StatusInternalServerError)
+				return
+			}
+			members = append(members, member)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(members)
+	}
+}
+
+// AddAudienceMemberHandler adds a user to an audience list. The new member can
+// immediately see every private post already shared with the list.
+func AddAudienceMemberHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var request struct {
+			AudienceID string `json:"audience_id"`
+			UserID     string `json:"user_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if request.AudienceID == "" || request.UserID == "" {
+			http.Error(w, "Missing audience_id or user_id", http.StatusBadRequest)
+			return
+		}
+		if request.UserID == userID {
+			http.Error(w, "You cannot add yourself to an audience", http.StatusBadRequest)
+			return
+		}
+
+		if err := checkAudienceOwner(db, request.AudienceID, userID); err != nil {
+			writeOwnerError(w, err)
+			return
+		}
+
+		var userExists bool
+		err = db.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)`, request.UserID).Scan(&userExists)
+		if err != nil || !userExists {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		result, err := db.Exec(`
+			INSERT INTO audience_members (audience_id, user_id) VALUES (?, ?)
+			ON CONFLICT(audience_id, user_id) DO NOTHING
+		`, request.AudienceID, request.UserID)
+		if err != nil {
+			http.Error(w, "Failed to add audience member", http.StatusInternalServerError)
+			return
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			http.Error(w, "Failed to determine affected rows", http.StatusInternalServerError)
+			return
+		}
+		if rowsAffected == 0 {
+			http.Error(w, "User is already in this audience", http.StatusConflict)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("Audience member added successfully"))
+	}
+}
+
+// RemoveAudienceMemberHandler removes a user from an audience list, revoking their
+// access to private posts shared with the list.
+func RemoveAudienceMemberHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var request struct {
+			AudienceID string `json:"audience_id"`
+			UserID     string `json:"user_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if request.AudienceID == "" || request.UserID == "" {
+			http.Error(w, "Missing audience_id or user_id", http.StatusBadRequest)
+			return
+		}
+
+		if err := checkAudienceOwner(db, request.AudienceID, userID); err != nil {
+			writeOwnerError(w, err)
+			return
+		}
+
+		result, err := db.Exec(`DELETE FROM audience_members WHERE audience_id = ? AND user_id = ?`, request.AudienceID, request.UserID)
+		if err != nil {
+			http.Error(w, "Failed to remove audience member", http.StatusInternalServerError)
+			return
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			http.Error(w, "Failed to determine affected rows", http.StatusInternalServerError)
+			return
+		}
+		if rowsAffected == 0 {
+			http.Error(w, "User is not in this audience", http.StatusNotFound)
+			return
+		}
+
+		w.Write([]byte("Audience member removed successfully"))
+	}
+}
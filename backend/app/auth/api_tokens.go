@@ -0,0 +1,436 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"social-network/app/sessions"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+
+	// Prefixes make leaked tokens easy to recognize and tell apart
+	personalTokenPrefix = "snp_"
+	accessTokenPrefix   = "sna_"
+	refreshTokenPrefix  = "snr_"
+)
+
+var errInvalidScope = errors.New("scopes must be any of: read, write, chat")
+
+// APIToken is a personal access token as listed to its owner. The token value is never returned again.
+type APIToken struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Scopes     []string `json:"scopes"`
+	CreatedAt  string   `json:"created_at"`
+	LastUsedAt string   `json:"last_used_at,omitempty"`
+	ExpiresAt  string   `json:"expires_at,omitempty"`
+}
+
+// normalizeScopes validates requested scopes and returns them space-separated in a stable order
+func normalizeScopes(requested []string, defaults []string) (string, error) {
+	if len(requested) == 0 {
+		requested = defaults
+	}
+	var scopes []string
+	for _, scope := range sessions.ValidScopes {
+		if contains(requested, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	for _, scope := range requested {
+		if !contains(sessions.ValidScopes, scope) {
+			return "", errInvalidScope
+		}
+	}
+	return strings.Join(scopes, " "), nil
+}
+
+// insertAPIToken stores a new token and returns its value and public ID. A zero ttl never expires.
+func insertAPIToken(tx *sql.Tx, userID, kind, prefix, name, scopes, pairID string, ttl time.Duration) (string, string, error) {
+	random, err := randomURLString(32)
+	if err != nil {
+		return "", "", err
+	}
+	token := prefix + random
+	tokenID := uuid.New().String()
+
+	var pair interface{}
+	if pairID != "" {
+		pair = pairID
+	}
+	if ttl > 0 {
+		_, err = tx.Exec(`
+			INSERT INTO api_tokens (id, user_id, token_hash, kind, name, scopes, pair_id, expires_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, datetime('now', ?))
+		`, tokenID, userID, sessions.HashSessionID(token), kind, name, scopes, pair, fmt.Sprintf("+%d seconds", int64(ttl.Seconds())))
+	} else {
+		_, err = tx.Exec(`
+			INSERT INTO api_tokens (id, user_id, token_hash, kind, name, scopes, pair_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, tokenID, userID, sessions.HashSessionID(token), kind, name, scopes, pair)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	return token, tokenID, nil
+}
+
+// writeTokenPair issues an access/refresh token pair and writes the OAuth-style token response
+func writeTokenPair(w http.ResponseWriter, db *sql.DB, userID, scopes string) {
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+
+	pairID := uuid.New().String()
+	accessToken, _, err := insertAPIToken(tx, userID, "access", accessTokenPrefix, "", scopes, pairID, accessTokenTTL)
+	if err != nil {
+		tx.Rollback()
+		http.Error(w, "Failed to issue tokens", http.StatusInternalServerError)
+		return
+	}
+	refreshToken, _, err := insertAPIToken(tx, userID, "refresh", refreshTokenPrefix, "", scopes, pairID, refreshTokenTTL)
+	if err != nil {
+		tx.Rollback()
+		http.Error(w, "Failed to issue tokens", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token":  accessToken,
+		"refresh_token": refreshToken,
+		"token_type":    "Bearer",
+		"expires_in":    int(accessTokenTTL.Seconds()),
+		"scope":         scopes,
+		"user_id":       userID,
+	})
+}
+
+// IssueTokenHandler signs in a non-browser client with its credentials and returns an
+// access/refresh token pair. Accounts with 2FA must also send a TOTP or recovery code.
+func IssueTokenHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed. Only POST is allowed.", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var request struct {
+			Identifier   string   `json:"identifier"`
+			Password     string   `json:"password"`
+			Code         string   `json:"code"`
+			RecoveryCode string   `json:"recovery_code"`
+			Scopes       []string `json:"scopes"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		scopes, err := normalizeScopes(request.Scopes, sessions.ValidScopes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var hashedPassword, userID string
+		var suspended, totpEnabled bool
+		query := `SELECT id, password, suspended, totp_enabled FROM users WHERE email = ? OR nickname = ?`
+		err = db.QueryRow(query, request.Identifier, request.Identifier).Scan(&userID, &hashedPassword, &suspended, &totpEnabled)
+		if err != nil {
+			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+			return
+		}
+		if err := verifyPassword(db, userID, hashedPassword, request.Password); err != nil {
+			writePasswordError(w, err, "Invalid credentials")
+			return
+		}
+		if suspended {
+			http.Error(w, "Your account has been suspended", http.StatusForbidden)
+			return
+		}
+
+		if totpEnabled {
+			if request.Code == "" && request.RecoveryCode == "" {
+				http.Error(w, "Two-factor code required", http.StatusUnauthorized)
+				return
+			}
+			ok, err := verifySecondFactor(db, userID, request.Code, request.RecoveryCode)
+			if err != nil {
+				http.Error(w, "Failed to verify code", http.StatusInternalServerError)
+				return
+			}
+			if !ok {
+				http.Error(w, "Invalid two-factor code", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		writeTokenPair(w, db, userID, scopes)
+	}
+}
+
+// RefreshTokenHandler exchanges a refresh token for a new pair. Refresh tokens are single-use:
+// the old pair is revoked as soon as the new one is issued.
+func RefreshTokenHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed. Only POST is allowed.", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var request struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if request.RefreshToken == "" {
+			http.Error(w, "Missing refresh_token", http.StatusBadRequest)
+			return
+		}
+
+		var userID, scopes, pairID string
+		err := db.QueryRow(`
+			SELECT api_tokens.user_id, api_tokens.scopes, api_tokens.pair_id
+			FROM api_tokens
+			JOIN users ON users.id = api_tokens.user_id
+			WHERE api_tokens.token_hash = ? AND api_tokens.kind = 'refresh'
+			  AND api_tokens.expires_at > CURRENT_TIMESTAMP AND users.suspended = 0
+		`, sessions.HashSessionID(request.RefreshToken)).Scan(&userID, &scopes, &pairID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+			return
+		} else if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		// Revoke the old pair; only one concurrent refresh can win
+		result, err := db.Exec(`DELETE FROM api_tokens WHERE pair_id = ?`, pairID)
+		if err != nil {
+			http.Error(w, "Failed to revoke old tokens", http.StatusInternalServerError)
+			return
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			http.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+			return
+		}
+
+		writeTokenPair(w, db, userID, scopes)
+	}
+}
+
+// RevokeTokenHandler revokes any token by value. Revoking an access or refresh token also revokes
+// the other half of its pair.
+func RevokeTokenHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed. Only POST is allowed.", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var request struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if request.Token == "" {
+			http.Error(w, "Missing token", http.StatusBadRequest)
+			return
+		}
+
+		tokenHash := sessions.HashSessionID(request.Token)
+		_, err := db.Exec(`
+			DELETE FROM api_tokens
+			WHERE token_hash = ?
+			   OR pair_id IN (SELECT pair_id FROM api_tokens WHERE token_hash = ? AND pair_id IS NOT NULL)
+		`, tokenHash, tokenHash)
+		if err != nil {
+			http.Error(w, "Failed to revoke token", http.StatusInternalServerError)
+			return
+		}
+
+		// Unknown tokens are not an error so the endpoint cannot be used to probe for valid tokens
+		w.Write([]byte("Token revoked successfully"))
+	}
+}
+
+// CreatePersonalTokenHandler creates a long-lived personal access token for scripts.
+// Tokens can only be created from a browser session so a token cannot mint broader tokens.
+func CreatePersonalTokenHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if sessions.BearerToken(r) != "" {
+			http.Error(w, "Personal access tokens can only be created from a logged-in session", http.StatusForbidden)
+			return
+		}
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var request struct {
+			Name          string   `json:"name"`
+			Scopes        []string `json:"scopes"`
+			ExpiresInDays int      `json:"expires_in_days,omitempty"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		name := strings.TrimSpace(request.Name)
+		if name == "" {
+			http.Error(w, "Token name cannot be empty", http.StatusBadRequest)
+			return
+		}
+		if len(name) > 50 {
+			http.Error(w, "Token name cannot exceed 50 characters", http.StatusBadRequest)
+			return
+		}
+		if request.ExpiresInDays < 0 || request.ExpiresInDays > 365 {
+			http.Error(w, "expires_in_days must be between 1 and 365, or omitted for no expiry", http.StatusBadRequest)
+			return
+		}
+		scopes, err := normalizeScopes(request.Scopes, []string{sessions.ScopeRead})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+			return
+		}
+		ttl := time.Duration(request.ExpiresInDays) * 24 * time.Hour
+		token, tokenID, err := insertAPIToken(tx, userID, "personal", personalTokenPrefix, name, scopes, "", ttl)
+		if err != nil {
+			tx.Rollback()
+			http.Error(w, "Failed to create token", http.StatusInternalServerError)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Token created successfully. Copy it now, it will not be shown again.",
+			"id":      tokenID,
+			"token":   token,
+			"scopes":  strings.Fields(scopes),
+		})
+	}
+}
+
+// GetPersonalTokensHandler lists the logged-in user's personal access tokens
+func GetPersonalTokensHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		rows, err := db.Query(`
+			SELECT id, name, scopes, created_at, COALESCE(last_used_at, ''), COALESCE(expires_at, '')
+			FROM api_tokens
+			WHERE user_id = ? AND kind = 'personal'
+			  AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
+			ORDER BY created_at DESC
+		`, userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch tokens", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		var tokens []APIToken
+		for rows.Next() {
+			var token APIToken
+			var scopes string
+			if err := rows.Scan(&token.ID, &token.Name, &scopes, &token.CreatedAt, &token.LastUsedAt, &token.ExpiresAt); err != nil {
+				http.Error(w, "Failed to parse tokens", http.StatusInternalServerError)
+				return
+			}
+			token.Scopes = strings.Fields(scopes)
+			tokens = append(tokens, token)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tokens)
+	}
+}
+
+// DeletePersonalTokenHandler revokes one of the logged-in user's personal access tokens
+func DeletePersonalTokenHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		tokenID := r.URL.Query().Get("id")
+		if tokenID == "" {
+			http.Error(w, "Missing token ID", http.StatusBadRequest)
+			return
+		}
+
+		result, err := db.Exec(`DELETE FROM api_tokens WHERE id = ? AND user_id = ? AND kind = 'personal'`, tokenID, userID)
+		if err != nil {
+			http.Error(w, "Failed to revoke token", http.StatusInternalServerError)
+			return
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			http.Error(w, "Failed to determine affected rows", http.StatusInternalServerError)
+			return
+		}
+		if rowsAffected == 0 {
+			http.Error(w, "Token not found", http.StatusNotFound)
+			return
+		}
+
+		w.Write([]byte("Token revoked successfully"))
+	}
+}
@@ -3,22 +3,21 @@ package auth
 import (
 	"database/sql"
 	"encoding/json"
-	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 	"social-network/app/chat"
+	"social-network/app/mailer"
 	"social-network/app/sessions"
 	"strings"
-	"time"
 
 	"github.com/google/uuid"
 )
 
-// RegisterHandler handles user registration
-func RegisterHandler(db *sql.DB) http.HandlerFunc {
+// RegisterHandler handles user registration and emails a verification link
+func RegisterHandler(db *sql.DB, m mailer.Mailer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Invalid request method. Only POST is allowed.", http.StatusMethodNotAllowed)
@@ -63,24 +62,20 @@ func RegisterHandler(db *sql.DB) http.HandlerFunc {
 
 		// Auto-generate a nickname if it's empty
 		if strings.TrimSpace(user.Nickname) == "" {
-			baseNickname := strings.Split(user.Email, "@")[0]
-			nicknameCandidate := baseNickname
-			count := 1
-			for {
-				var exists bool
-				err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE nickname = ?)", nicknameCandidate).Scan(&exists)
-				if err != nil {
-					log.Println("Failed to check duplicate nickname:", err)
-					http.Error(w, "Internal server error", http.StatusInternalServerError)
-					return
-				}
-				if !exists {
-					break
-				}
-				count++
-				nicknameCandidate = fmt.Sprintf("%s%d", baseNickname, count)
+			nickname, err := GenerateNickname(db, strings.Split(user.Email, "@")[0])
+			if err != nil {
+				log.Println("Failed to check duplicate nickname:", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
 			}
-			user.Nickname = nicknameCandidate
+			user.Nickname = nickname
+		} else if taken, err := NicknameTaken(db, user.Nickname, ""); err != nil {
+			log.Println("Failed to check duplicate nickname:", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		} else if taken {
+			http.Error(w, "Nickname already taken", http.StatusConflict)
+			return
 		}
 
 		// Handle avatar upload
@@ -142,6 +137,11 @@ func RegisterHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		// A failed email should not undo the registration; the user can ask for a new link
+		if err := sendVerificationEmail(db, m, userID, user.Email); err != nil {
+			log.Printf("Error sending verification email: %v", err)
+		}
+
 		w.WriteHeader(http.StatusCreated)
 		json.NewEncoder(w).Encode(map[string]string{
 			"message": "User registered successfully",
@@ -174,6 +174,7 @@ func LoginHandler(db *sql.DB) http.HandlerFunc {
 		var creds struct {
 			Identifier string `json:"identifier"`
 			Password   string `json:"password"`
+			RememberMe bool   `json:"remember_me"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
 			http.Error(w, "Invalid request body", http.StatusBadRequest)
@@ -181,55 +182,66 @@ func LoginHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		var hashedPassword, userID string
-		query := `SELECT id, password FROM users WHERE email = ? OR nickname = ?`
-		err := db.QueryRow(query, creds.Identifier, creds.Identifier).Scan(&userID, &hashedPassword)
-		if err != nil || CheckPassword(hashedPassword, creds.Password) != nil {
+		var suspended, totpEnabled bool
+		query := `SELECT id, password, suspended, totp_enabled FROM users WHERE email = ? OR nickname = ?`
+		err := db.QueryRow(query, creds.Identifier, creds.Identifier).Scan(&userID, &hashedPassword, &suspended, &totpEnabled)
+		if err != nil {
 			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 			return
 		}
 
-		sessionID := uuid.New().String()
-		expiresAt := time.Now().Add(24 * time.Hour)
-		_, err = db.Exec(
-			`INSERT INTO active_sessions (session_id, user_id, expires_at) VALUES (?, ?, ?)`,
-			sessionID, userID, expiresAt,
-		)
-		if err != nil {
-			http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		// Repeated wrong passwords lock the account with exponential backoff
+		if err := verifyPassword(db, userID, hashedPassword, creds.Password); err != nil {
+			writePasswordError(w, err, "Invalid credentials")
 			return
 		}
 
-		// Set session_id cookie
-		http.SetCookie(w, &http.Cookie{
-			Name:     "social-network-session",
-			Value:    sessionID,
-			Path:     "/",
-			HttpOnly: true,
-			Secure:   true,                    // Ensure secure transport
-			SameSite: http.SameSiteStrictMode, // Prevent CSRF attacks
-			Expires:  expiresAt,               // Set expiration time
-		})
+		// Suspended accounts cannot start new sessions
+		if suspended {
+			http.Error(w, "Your account has been suspended", http.StatusForbidden)
+			return
+		}
 
-		// Set user_id cookie
-		http.SetCookie(w, &http.Cookie{
-			Name:     "user_id",
-			Value:    userID,
-			Path:     "/",
-			HttpOnly: false,
-			Secure:   true, // Ensure it's only sent over HTTPS
-			SameSite: http.SameSiteStrictMode,
-			Expires:  expiresAt,
-		})
+		// With 2FA enabled the session is only issued once the second factor is verified
+		if totpEnabled {
+			challengeToken, err := createLoginChallenge(db, userID, creds.RememberMe)
+			if err != nil {
+				http.Error(w, "Failed to start two-factor login", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"message":             "Two-factor authentication required",
+				"two_factor_required": true,
+				"challenge_token":     challengeToken,
+			})
+			return
+		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{
-			"message":    "Login successful",
-			"session_id": sessionID,
-			"user_id":    userID, // Optionally return in JSON for frontend convenience
-		})
+		startSession(w, r, db, userID, creds.RememberMe)
 	}
 }
 
+// startSession creates a session for an authenticated user, sets the cookies and writes the login response
+func startSession(w http.ResponseWriter, r *http.Request, db *sql.DB, userID string, rememberMe bool) {
+	sessionID, err := sessions.CreateSession(db, r, userID, rememberMe)
+	if err != nil {
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+
+	// Set session_id and user_id cookies
+	sessions.SetSessionCookies(w, sessionID, userID, rememberMe)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message":    "Login successful",
+		"session_id": sessionID,
+		"user_id":    userID, // Optionally return in JSON for frontend convenience
+		"csrf_token": sessions.CSRFToken(sessionID),
+	})
+}
+
 // In your auth/logout handler (assuming similar structure to your other handlers)
 func LogoutHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -245,10 +257,10 @@ func LogoutHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		sessionID := cookie.Value
+		sessionID := sessions.HashSessionID(cookie.Value)
 
 		// Get user ID from session (using your existing helper)
-		userID, err := sessions.GetUserIDFromSession(r)
+		userID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
@@ -286,8 +298,83 @@ func LogoutHandler(db *sql.DB) http.HandlerFunc {
 			Secure:   true,
 			SameSite: http.SameSiteStrictMode,
 		})
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessions.CSRFCookieName,
+			Value:    "",
+			Path:     "/",
+			MaxAge:   -1,
+			Secure:   true,
+			SameSite: http.SameSiteStrictMode,
+		})
 
 		w.Write([]byte("Logout successful"))
 	}
 }
 
+
+// ChangePasswordHandler updates the logged-in user's password after checking the current one.
+// Every other session and all API tokens of the user are revoked so stolen credentials stop working.
+func ChangePasswordHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed. Only POST is allowed.", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var request struct {
+			CurrentPassword string `json:"current_password"`
+			NewPassword     string `json:"new_password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		var hashedPassword string
+		err = db.QueryRow(`SELECT password FROM users WHERE id = ?`, userID).Scan(&hashedPassword)
+		if err != nil {
+			http.Error(w, "Failed to fetch user", http.StatusInternalServerError)
+			return
+		}
+		if err := verifyPassword(db, userID, hashedPassword, request.CurrentPassword); err != nil {
+			writePasswordError(w, err, "Current password is incorrect")
+			return
+		}
+
+		if err := ValidatePassword(request.NewPassword); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		newHash, err := HashPassword(request.NewPassword)
+		if err != nil {
+			http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+			return
+		}
+
+		if _, err := db.Exec(`UPDATE users SET password = ? WHERE id = ?`, newHash, userID); err != nil {
+			http.Error(w, "Failed to update password", http.StatusInternalServerError)
+			return
+		}
+
+		// Sign out every other device and revoke all API tokens, personal access tokens included,
+		// so whoever knew the old password loses access
+		currentSessionID := sessions.CurrentSessionID(r)
+		if _, err := sessions.RevokeUserSessions(db, userID, currentSessionID); err != nil {
+			http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+			return
+		}
+		if err := sessions.RevokeAllTokens(db, userID); err != nil {
+			http.Error(w, "Failed to revoke tokens", http.StatusInternalServerError)
+			return
+		}
+
+		w.Write([]byte("Password changed successfully"))
+	}
+}
@@ -1,27 +1,35 @@
 package auth
 
 import (
-	"context"
 	"database/sql"
+	"errors"
 	"net/http"
-	"time"
+	"social-network/app/sessions"
 )
 
+// AuthMiddleware authenticates the request and loads the user's ID, role and privacy flag into the
+// request context once, so handlers read them with sessions.UserFromContext instead of hitting the
+// session store themselves
 func AuthMiddleware(db *sql.DB, next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        // (1) Retrieve the session ID from the cookie
-        cookie, err := r.Cookie("social-network-session")
-        if err != nil || cookie.Value == "" {
-            http.Error(w, "Unauthorized", http.StatusUnauthorized)
+        // (1) Validate the session cookie or bearer token, renewing sessions on use
+        userID, err := sessions.Authenticate(db, r)
+        if err != nil {
+            switch {
+            case errors.Is(err, sessions.ErrInsufficientScope):
+                http.Error(w, "Forbidden: "+err.Error(), http.StatusForbidden)
+            case errors.Is(err, sessions.ErrNoSession), errors.Is(err, sessions.ErrInvalidSession), errors.Is(err, sessions.ErrInvalidToken):
+                http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+            default:
+                http.Error(w, "Internal server error", http.StatusInternalServerError)
+            }
             return
         }
 
-        sessionID := cookie.Value
-
-        // (2) Validate the session in the database
-        var userID string
-        query := `SELECT user_id FROM active_sessions WHERE session_id = ? AND expires_at > ?`
-        err = db.QueryRow(query, sessionID, time.Now()).Scan(&userID)
+        // (2) Load the user; sessions of deleted or suspended users are no longer valid
+        user := sessions.User{ID: userID}
+        var suspended bool
+        err = db.QueryRow(`SELECT role, COALESCE(private, 0), COALESCE(suspended, 0) FROM users WHERE id = ?`, userID).Scan(&user.Role, &user.Private, &suspended)
         if err == sql.ErrNoRows {
             http.Error(w, "Unauthorized", http.StatusUnauthorized)
             return
@@ -29,9 +37,31 @@ func AuthMiddleware(db *sql.DB, next http.Handler) http.Handler {
             http.Error(w, "Internal server error", http.StatusInternalServerError)
             return
         }
+        if suspended {
+            http.Error(w, "Your account has been suspended", http.StatusForbidden)
+            return
+        }
+
+        // (3) Add the user to the request context
+        next.ServeHTTP(w, r.WithContext(sessions.WithUser(r.Context(), user)))
+    })
+}
+
+// RequireRole only lets through users holding one of the given roles. It must be mounted behind
+// AuthMiddleware and rejects requests that did not pass through it.
+func RequireRole(roles []string, next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        user, ok := sessions.UserFromContext(r.Context())
+        if !ok {
+            http.Error(w, "Unauthorized", http.StatusUnauthorized)
+            return
+        }
+
+        if !contains(roles, user.Role) {
+            http.Error(w, "Forbidden: insufficient role", http.StatusForbidden)
+            return
+        }
 
-        // (3) Add the user ID to the request context
-        ctx := context.WithValue(r.Context(), "user_id", userID)
-        next.ServeHTTP(w, r.WithContext(ctx))
+        next.ServeHTTP(w, r)
     })
 }
@@ -1,8 +1,11 @@
 package auth
 
 import (
+	"database/sql"
 	"golang.org/x/crypto/bcrypt"
 	"errors"
+	"fmt"
+	"net/url"
 	"regexp"
 	"time"
 )
@@ -93,6 +96,45 @@ func ValidateDateOfBirth(dateOfBirth string) error {
 
 	return nil
 }
+
+// ValidateLocation validates the profile location (max 50 characters, optional)
+func ValidateLocation(location string) error {
+	if len(location) > 50 {
+		return errors.New("location must not exceed 50 characters")
+	}
+	return nil
+}
+
+// ValidatePronouns validates pronouns such as "she/her" (letters separated by up to two slashes, optional)
+func ValidatePronouns(pronouns string) error {
+	pronounsRegex := `^[a-zA-Z]{1,10}(/[a-zA-Z]{1,10}){0,2}$`
+	matched, _ := regexp.MatchString(pronounsRegex, pronouns)
+	if !matched {
+		return errors.New("pronouns must be up to three words of letters separated by slashes, e.g. she/her")
+	}
+	return nil
+}
+
+// ValidateLink validates a profile website link (absolute http or https URL, max 200 characters)
+func ValidateLink(link string) error {
+	if len(link) > 200 {
+		return errors.New("link must not exceed 200 characters")
+	}
+	parsed, err := url.Parse(link)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return errors.New("link must be a valid http or https URL")
+	}
+	return nil
+}
+
+// ValidateLinkLabel validates the text shown for a profile link (max 30 characters, optional)
+func ValidateLinkLabel(label string) error {
+	if len(label) > 30 {
+		return errors.New("link label must not exceed 30 characters")
+	}
+	return nil
+}
+
 // ValidateUser validates all fields for a user during registration
 func ValidateUser(user User) error {
 	if err := ValidateEmail(user.Email); err != nil {
@@ -135,3 +177,41 @@ func HashPassword(password string) (string, error) {
 func CheckPassword(hashedPassword, password string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 }
+
+// NicknameTaken reports whether nickname belongs to an account other than userID, either as its
+// current nickname or as one it gave up recently and is still reserved for it. userID is empty for
+// new accounts.
+func NicknameTaken(db *sql.DB, nickname, userID string) (bool, error) {
+	var taken bool
+	err := db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM users WHERE nickname = ?1 AND id != ?2)
+		    OR EXISTS(SELECT 1 FROM nickname_history WHERE nickname = ?1 AND user_id != ?2 AND reserved_until > CURRENT_TIMESTAMP)`,
+		nickname, userID).Scan(&taken)
+	return taken, err
+}
+
+// GenerateNickname derives a free nickname from a base such as the email's local part.
+// Characters ValidateNickname rejects are dropped and a counter is appended on collisions.
+func GenerateNickname(db *sql.DB, base string) (string, error) {
+	baseNickname := regexp.MustCompile(`[^a-zA-Z0-9]`).ReplaceAllString(base, "")
+	if len(baseNickname) > 12 {
+		baseNickname = baseNickname[:12]
+	}
+	if baseNickname == "" {
+		baseNickname = "user"
+	}
+
+	nicknameCandidate := baseNickname
+	count := 1
+	for {
+		exists, err := NicknameTaken(db, nicknameCandidate, "")
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return nicknameCandidate, nil
+		}
+		count++
+		nicknameCandidate = fmt.Sprintf("%s%d", baseNickname, count)
+	}
+}
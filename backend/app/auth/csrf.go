@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"social-network/app/sessions"
+)
+
+// CSRFMiddleware protects cookie-authenticated state-changing requests. A mutating request that
+// carries a session cookie must come from the frontend origin (when the browser says where it came
+// from) and repeat the session's CSRF token in the X-CSRF-Token header. Safe methods and bearer-token
+// requests, which browsers never attach automatically, are exempt.
+func CSRFMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if sessions.BearerToken(r) != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Without a session cookie the request carries no ambient credentials to abuse
+		sessionToken, _ := sessions.GetSessionValue(r, sessions.SessionCookieName)
+		if sessionToken == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !trustedOrigin(r) {
+			http.Error(w, "Forbidden: cross-site request rejected", http.StatusForbidden)
+			return
+		}
+
+		token := r.Header.Get(sessions.CSRFHeaderName)
+		expected := sessions.CSRFToken(sessionToken)
+		if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+			http.Error(w, "Forbidden: missing or invalid CSRF token", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// trustedOrigin checks the Origin header, falling back to Referer, against the frontend origin and
+// the API's own host. Requests without either header are left to the token check.
+func trustedOrigin(r *http.Request) bool {
+	source := r.Header.Get("Origin")
+	if source == "" {
+		source = r.Header.Get("Referer")
+	}
+	if source == "" {
+		return true
+	}
+
+	origin, err := url.Parse(source)
+	if err != nil || origin.Host == "" {
+		return false
+	}
+	frontend, err := url.Parse(appBaseURL())
+	if err == nil && origin.Scheme == frontend.Scheme && origin.Host == frontend.Host {
+		return true
+	}
+	return origin.Host == r.Host
+}
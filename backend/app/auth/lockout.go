@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Accounts are locked after lockoutThreshold consecutive wrong passwords. Each further
+// failure doubles the lock, starting at lockoutBaseDelay and capped at lockoutMaxDelay.
+const (
+	lockoutThreshold = 5
+	lockoutBaseDelay = 30 * time.Second
+	lockoutMaxDelay  = time.Hour
+)
+
+var errWrongPassword = errors.New("wrong password")
+
+// lockoutError is returned while an account is locked
+type lockoutError struct {
+	retryAfter time.Duration
+}
+
+func (e *lockoutError) Error() string {
+	return fmt.Sprintf("too many failed attempts, try again in %d seconds", int(e.retryAfter.Seconds()))
+}
+
+// lockoutDelay returns how long an account stays locked after the given number of failures
+func lockoutDelay(attempts int) time.Duration {
+	if attempts < lockoutThreshold {
+		return 0
+	}
+	delay := lockoutBaseDelay
+	for i := lockoutThreshold; i < attempts && delay < lockoutMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > lockoutMaxDelay {
+		delay = lockoutMaxDelay
+	}
+	return delay
+}
+
+// verifyPassword runs CheckPassword for a user while enforcing the account lockout.
+// It returns a *lockoutError while locked, errWrongPassword on a mismatch and nil on success.
+func verifyPassword(db *sql.DB, userID, hashedPassword, password string) error {
+	var attempts, lockedFor int
+	err := db.QueryRow(`
+		SELECT failed_login_attempts,
+		       COALESCE(CAST(strftime('%s', locked_until) AS INTEGER) - CAST(strftime('%s', 'now') AS INTEGER), 0)
+		FROM users WHERE id = ?
+	`, userID).Scan(&attempts, &lockedFor)
+	if err != nil {
+		return err
+	}
+	if lockedFor > 0 {
+		return &lockoutError{retryAfter: time.Duration(lockedFor) * time.Second}
+	}
+
+	if CheckPassword(hashedPassword, password) != nil {
+		// Count the failure atomically so concurrent attempts cannot slip past the threshold
+		err = db.QueryRow(`
+			UPDATE users SET failed_login_attempts = failed_login_attempts + 1 WHERE id = ?
+			RETURNING failed_login_attempts
+		`, userID).Scan(&attempts)
+		if err != nil {
+			return err
+		}
+		if delay := lockoutDelay(attempts); delay > 0 {
+			// Never shorten a lock a concurrent failure already extended
+			_, err = db.Exec(`UPDATE users SET locked_until = MAX(COALESCE(locked_until, ''), datetime('now', ?)) WHERE id = ?`,
+				fmt.Sprintf("+%d seconds", int64(delay.Seconds())), userID)
+			if err != nil {
+				return err
+			}
+		}
+		return errWrongPassword
+	}
+
+	if attempts > 0 {
+		if _, err := db.Exec(`UPDATE users SET failed_login_attempts = 0, locked_until = NULL WHERE id = ?`, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writePasswordError maps a verifyPassword error to an HTTP response
+func writePasswordError(w http.ResponseWriter, err error, wrongPasswordMessage string) {
+	var locked *lockoutError
+	switch {
+	case errors.As(err, &locked):
+		seconds := strconv.Itoa(int(locked.retryAfter.Seconds()))
+		w.Header().Set("Retry-After", seconds)
+		http.Error(w, "Too many failed attempts. Try again in "+seconds+" seconds", http.StatusTooManyRequests)
+	case err == errWrongPassword:
+		http.Error(w, wrongPasswordMessage, http.StatusUnauthorized)
+	default:
+		http.Error(w, "Database error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"social-network/app/mailer"
+	"social-network/app/sessions"
+	"strings"
+)
+
+// sendVerificationEmail issues an email verification token and mails the link to the user
+func sendVerificationEmail(db *sql.DB, m mailer.Mailer, userID, email string) error {
+	token, err := createAuthToken(db, userID, purposeEmailVerification, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	body := "Welcome to the social network!\n\n" +
+		"Confirm your email address by opening this link within 48 hours:\n" +
+		frontendURL("/verify-email", token) + "\n"
+	return m.Send(email, "Confirm your email address", body)
+}
+
+// HasPassword reports whether the user can sign in with a password, which accounts provisioned
+// through social login cannot
+func HasPassword(db *sql.DB, userID string) (bool, error) {
+	var hashedPassword string
+	err := db.QueryRow(`SELECT password FROM users WHERE id = ?`, userID).Scan(&hashedPassword)
+	return hashedPassword != "", err
+}
+
+// SendConfirmationEmail mails a user without a password a single-use link to confirm a destructive
+// change, such as deleting their account. ConfirmIdentity redeems the token in place of a password.
+func SendConfirmationEmail(db *sql.DB, m mailer.Mailer, userID, action, path string) error {
+	var email string
+	if err := db.QueryRow(`SELECT email FROM users WHERE id = ?`, userID).Scan(&email); err != nil {
+		return err
+	}
+	token, err := createAuthToken(db, userID, purposeConfirmIdentity, confirmIdentityTTL)
+	if err != nil {
+		return err
+	}
+	body := "We received a request to " + action + ".\n\n" +
+		"Confirm it by opening this link within an hour:\n" +
+		frontendURL(path, token) + "\n\n" +
+		"If you did not request this, you can ignore this email."
+	return m.Send(email, "Confirm your request", body)
+}
+
+// RequestPasswordResetHandler emails a password reset link. The response is the same
+// whether or not the email belongs to an account so it cannot be used to probe for users.
+func RequestPasswordResetHandler(db *sql.DB, m mailer.Mailer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed. Only POST is allowed.", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var request struct {
+			Email string `json:"email"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		email := strings.TrimSpace(request.Email)
+		if err := ValidateEmail(email); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var userID string
+		err := db.QueryRow(`SELECT id FROM users WHERE email = ?`, email).Scan(&userID)
+		if err == nil {
+			token, err := createAuthToken(db, userID, purposePasswordReset, passwordResetTTL)
+			if err != nil {
+				http.Error(w, "Failed to create reset token", http.StatusInternalServerError)
+				return
+			}
+			body := "We received a request to reset your password.\n\n" +
+				"Open this link within one hour to choose a new password:\n" +
+				frontendURL("/reset-password", token) + "\n\n" +
+				"If you did not ask for this, you can ignore this email.\n"
+			if err := m.Send(email, "Reset your password", body); err != nil {
+				log.Printf("Error sending password reset email: %v", err)
+			}
+		} else if err != sql.ErrNoRows {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Write([]byte("If an account exists for this email, a reset link has been sent"))
+	}
+}
+
+// ResetPasswordHandler sets a new password using a reset token and signs the user out everywhere
+func ResetPasswordHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed. Only POST is allowed.", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var request struct {
+			Token       string `json:"token"`
+			NewPassword string `json:"new_password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if request.Token == "" {
+			http.Error(w, "Missing token", http.StatusBadRequest)
+			return
+		}
+
+		// Validate before redeeming so a weak password does not burn the token
+		if err := ValidatePassword(request.NewPassword); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		newHash, err := HashPassword(request.NewPassword)
+		if err != nil {
+			http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+			return
+		}
+
+		userID, err := consumeAuthToken(db, request.Token, purposePasswordReset)
+		if err == errInvalidToken {
+			http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to redeem token", http.StatusInternalServerError)
+			return
+		}
+
+		if _, err := db.Exec(`UPDATE users SET password = ?, failed_login_attempts = 0, locked_until = NULL WHERE id = ?`, newHash, userID); err != nil {
+			http.Error(w, "Failed to update password", http.StatusInternalServerError)
+			return
+		}
+
+		// Whoever held the old password must not keep their sessions or any API token
+		if _, err := sessions.RevokeUserSessions(db, userID, ""); err != nil {
+			http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+			return
+		}
+		if err := sessions.RevokeAllTokens(db, userID); err != nil {
+			http.Error(w, "Failed to revoke tokens", http.StatusInternalServerError)
+			return
+		}
+
+		w.Write([]byte("Password reset successfully"))
+	}
+}
+
+// SendVerificationEmailHandler re-sends the email verification link to the logged-in user
+func SendVerificationEmailHandler(db *sql.DB, m mailer.Mailer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed. Only POST is allowed.", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var email string
+		var verified bool
+		err = db.QueryRow(`SELECT email, email_verified FROM users WHERE id = ?`, userID).Scan(&email, &verified)
+		if err != nil {
+			http.Error(w, "Failed to fetch user", http.StatusInternalServerError)
+			return
+		}
+		if verified {
+			http.Error(w, "Email is already verified", http.StatusConflict)
+			return
+		}
+
+		if err := sendVerificationEmail(db, m, userID, email); err != nil {
+			log.Printf("Error sending verification email: %v", err)
+			http.Error(w, "Failed to send verification email", http.StatusInternalServerError)
+			return
+		}
+
+		w.Write([]byte("Verification email sent successfully"))
+	}
+}
+
+// VerifyEmailHandler confirms the user's email address using a verification token
+func VerifyEmailHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed. Only POST is allowed.", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var request struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if request.Token == "" {
+			http.Error(w, "Missing token", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := consumeAuthToken(db, request.Token, purposeEmailVerification)
+		if err == errInvalidToken {
+			http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to redeem token", http.StatusInternalServerError)
+			return
+		}
+
+		if _, err := db.Exec(`UPDATE users SET email_verified = 1 WHERE id = ?`, userID); err != nil {
+			http.Error(w, "Failed to verify email", http.StatusInternalServerError)
+			return
+		}
+
+		w.Write([]byte("Email verified successfully"))
+	}
+}
@@ -0,0 +1,466 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"social-network/app/sessions"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// oidcStateCookieName holds a hash of the state of the flow started in this browser. The callback
+// only accepts a state that matches it, so an attacker cannot complete their own flow in a victim's
+// browser. It is Lax rather than Strict because the provider redirects back from another site.
+const oidcStateCookieName = "oidc_state"
+
+var (
+	errEmailRequired = errors.New("identity provider did not share an email address")
+	errEmailTaken    = errors.New("an account with this email already exists")
+)
+
+// LinkedIdentity is an external provider account linked to the logged-in user
+type LinkedIdentity struct {
+	Provider  string `json:"provider"`
+	Email     string `json:"email"`
+	CreatedAt string `json:"created_at"`
+}
+
+// redirectToFrontend sends the browser back to a frontend page, using APP_BASE_URL when set
+func redirectToFrontend(w http.ResponseWriter, r *http.Request, path string, params url.Values) {
+	target := appBaseURL() + path
+	if len(params) > 0 {
+		target += "?" + params.Encode()
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// startOIDCFlow stores a single-use state with its PKCE verifier and nonce, then redirects to the provider
+func startOIDCFlow(w http.ResponseWriter, r *http.Request, db *sql.DB, provider *OIDCProvider, linkUserID string, rememberMe bool) {
+	state, err := randomURLString(32)
+	if err != nil {
+		http.Error(w, "Failed to start login", http.StatusInternalServerError)
+		return
+	}
+	nonce, err := randomURLString(32)
+	if err != nil {
+		http.Error(w, "Failed to start login", http.StatusInternalServerError)
+		return
+	}
+	codeVerifier, err := randomURLString(48)
+	if err != nil {
+		http.Error(w, "Failed to start login", http.StatusInternalServerError)
+		return
+	}
+
+	authURL, err := provider.AuthorizationURL(state, nonce, codeVerifier)
+	if err != nil {
+		log.Printf("Error contacting identity provider %s: %v", provider.Name, err)
+		http.Error(w, "Identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	// Drop abandoned flows before adding a new one
+	if _, err := db.Exec(`DELETE FROM oauth_states WHERE expires_at <= CURRENT_TIMESTAMP`); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	var linkUser interface{}
+	if linkUserID != "" {
+		linkUser = linkUserID
+	}
+	_, err = db.Exec(`
+		INSERT INTO oauth_states (state, provider, code_verifier, nonce, link_user_id, remember_me, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, datetime('now', '+600 seconds'))
+	`, state, provider.Name, codeVerifier, nonce, linkUser, rememberMe)
+	if err != nil {
+		http.Error(w, "Failed to start login", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    hashToken(state),
+		Path:     "/oauth/callback",
+		MaxAge:   600, // Same lifetime as the stored state
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// GetOIDCProvidersHandler lists the configured identity providers so the frontend can offer them
+func GetOIDCProvidersHandler(providers map[string]*OIDCProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		names := make([]string, 0, len(providers))
+		for name := range providers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(names)
+	}
+}
+
+// OIDCLoginHandler starts signing in (or signing up) with an external provider
+func OIDCLoginHandler(db *sql.DB, providers map[string]*OIDCProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		provider, ok := providers[r.URL.Query().Get("provider")]
+		if !ok {
+			http.Error(w, "Unknown identity provider", http.StatusBadRequest)
+			return
+		}
+
+		startOIDCFlow(w, r, db, provider, "", r.URL.Query().Get("remember_me") == "true")
+	}
+}
+
+// OIDCLinkHandler starts linking an external provider to the logged-in user's account
+func OIDCLinkHandler(db *sql.DB, providers map[string]*OIDCProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		provider, ok := providers[r.URL.Query().Get("provider")]
+		if !ok {
+			http.Error(w, "Unknown identity provider", http.StatusBadRequest)
+			return
+		}
+
+		var linked bool
+		err = db.QueryRow(`SELECT EXISTS(SELECT 1 FROM oauth_identities WHERE user_id = ? AND provider = ?)`, userID, provider.Name).Scan(&linked)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if linked {
+			http.Error(w, "This provider is already linked to your account", http.StatusConflict)
+			return
+		}
+
+		startOIDCFlow(w, r, db, provider, userID, false)
+	}
+}
+
+// OIDCCallbackHandler completes the authorization code flow. Depending on the stored state it links
+// the identity to the user who started the flow, signs in the linked user, or provisions a new account.
+func OIDCCallbackHandler(db *sql.DB, providers map[string]*OIDCProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		state := query.Get("state")
+		if state == "" {
+			redirectToFrontend(w, r, "/login", url.Values{"error": {"invalid_state"}})
+			return
+		}
+
+		// The state must belong to the flow this browser started
+		stateCookie, err := r.Cookie(oidcStateCookieName)
+		if err != nil || subtle.ConstantTimeCompare([]byte(stateCookie.Value), []byte(hashToken(state))) != 1 {
+			redirectToFrontend(w, r, "/login", url.Values{"error": {"invalid_state"}})
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     oidcStateCookieName,
+			Value:    "",
+			Path:     "/oauth/callback",
+			MaxAge:   -1,
+			HttpOnly: true,
+			Secure:   true,
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		// The state is single-use
+		var providerName, codeVerifier, nonce string
+		var linkUserID sql.NullString
+		var rememberMe bool
+		err = db.QueryRow(`
+			DELETE FROM oauth_states WHERE state = ? AND expires_at > CURRENT_TIMESTAMP
+			RETURNING provider, code_verifier, nonce, link_user_id, remember_me
+		`, state).Scan(&providerName, &codeVerifier, &nonce, &linkUserID, &rememberMe)
+		if err == sql.ErrNoRows {
+			redirectToFrontend(w, r, "/login", url.Values{"error": {"invalid_state"}})
+			return
+		} else if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		errorPage := "/login"
+		if linkUserID.Valid {
+			errorPage = "/settings"
+		}
+
+		provider, ok := providers[providerName]
+		if !ok {
+			redirectToFrontend(w, r, errorPage, url.Values{"error": {"unknown_provider"}})
+			return
+		}
+		if providerError := query.Get("error"); providerError != "" {
+			redirectToFrontend(w, r, errorPage, url.Values{"error": {"access_denied"}})
+			return
+		}
+
+		claims, err := provider.Exchange(query.Get("code"), codeVerifier, nonce)
+		if err != nil {
+			log.Printf("OIDC login with %s failed: %v", provider.Name, err)
+			redirectToFrontend(w, r, errorPage, url.Values{"error": {"login_failed"}})
+			return
+		}
+
+		var ownerID string
+		err = db.QueryRow(`SELECT user_id FROM oauth_identities WHERE provider = ? AND subject = ?`, provider.Name, claims.Subject).Scan(&ownerID)
+		if err != nil && err != sql.ErrNoRows {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		// Linking an additional provider to an existing account. The link was started from the user's
+		// session and the state cookie ties the callback to that browser, so the stored user is trusted:
+		// the Strict session cookie is not sent on the provider's cross-site redirect.
+		if linkUserID.Valid {
+			if ownerID != "" {
+				redirectToFrontend(w, r, errorPage, url.Values{"error": {"identity_in_use"}})
+				return
+			}
+			_, err = db.Exec(`
+				INSERT INTO oauth_identities (id, user_id, provider, subject, email) VALUES (?, ?, ?, ?, ?)
+			`, uuid.New().String(), linkUserID.String, provider.Name, claims.Subject, claims.Email)
+			if err != nil {
+				redirectToFrontend(w, r, errorPage, url.Values{"error": {"link_failed"}})
+				return
+			}
+			redirectToFrontend(w, r, "/settings", url.Values{"linked": {provider.Name}})
+			return
+		}
+
+		// First sign-in with this identity: provision a new account
+		if ownerID == "" {
+			ownerID, err = provisionOIDCUser(db, provider.Name, claims)
+			if err == errEmailTaken {
+				redirectToFrontend(w, r, errorPage, url.Values{"error": {"account_exists"}})
+				return
+			} else if err == errEmailRequired {
+				redirectToFrontend(w, r, errorPage, url.Values{"error": {"email_required"}})
+				return
+			} else if err != nil {
+				log.Printf("Failed to provision user from %s: %v", provider.Name, err)
+				redirectToFrontend(w, r, errorPage, url.Values{"error": {"login_failed"}})
+				return
+			}
+		}
+
+		var suspended, totpEnabled bool
+		err = db.QueryRow(`SELECT suspended, totp_enabled FROM users WHERE id = ?`, ownerID).Scan(&suspended, &totpEnabled)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if suspended {
+			redirectToFrontend(w, r, errorPage, url.Values{"error": {"suspended"}})
+			return
+		}
+
+		// Accounts with 2FA still have to pass the second step
+		if totpEnabled {
+			challengeToken, err := createLoginChallenge(db, ownerID, rememberMe)
+			if err != nil {
+				http.Error(w, "Failed to start two-factor login", http.StatusInternalServerError)
+				return
+			}
+			redirectToFrontend(w, r, "/login/2fa", url.Values{"challenge_token": {challengeToken}})
+			return
+		}
+
+		sessionID, err := sessions.CreateSession(db, r, ownerID, rememberMe)
+		if err != nil {
+			http.Error(w, "Failed to create session", http.StatusInternalServerError)
+			return
+		}
+		sessions.SetSessionCookies(w, sessionID, ownerID, rememberMe)
+		redirectToFrontend(w, r, "/", nil)
+	}
+}
+
+// GetLinkedIdentitiesHandler lists the external providers linked to the logged-in user
+func GetLinkedIdentitiesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		rows, err := db.Query(`
+			SELECT provider, COALESCE(email, ''), created_at FROM oauth_identities
+			WHERE user_id = ? ORDER BY created_at ASC
+		`, userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch linked providers", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		var identities []LinkedIdentity
+		for rows.Next() {
+			var identity LinkedIdentity
+			if err := rows.Scan(&identity.Provider, &identity.Email, &identity.CreatedAt); err != nil {
+				http.Error(w, "Failed to parse linked providers", http.StatusInternalServerError)
+				return
+			}
+			identities = append(identities, identity)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(identities)
+	}
+}
+
+// UnlinkIdentityHandler removes a linked provider. The last sign-in method of an account
+// without a password cannot be removed.
+func UnlinkIdentityHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		provider := r.URL.Query().Get("provider")
+		if provider == "" {
+			http.Error(w, "Missing provider", http.StatusBadRequest)
+			return
+		}
+
+		var hasPassword bool
+		var identities int
+		err = db.QueryRow(`
+			SELECT password != '', (SELECT COUNT(*) FROM oauth_identities WHERE user_id = users.id)
+			FROM users WHERE id = ?
+		`, userID).Scan(&hasPassword, &identities)
+		if err != nil {
+			http.Error(w, "Failed to fetch user", http.StatusInternalServerError)
+			return
+		}
+		if !hasPassword && identities <= 1 {
+			http.Error(w, "Set a password before removing your only sign-in method", http.StatusConflict)
+			return
+		}
+
+		result, err := db.Exec(`DELETE FROM oauth_identities WHERE user_id = ? AND provider = ?`, userID, provider)
+		if err != nil {
+			http.Error(w, "Failed to unlink provider", http.StatusInternalServerError)
+			return
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			http.Error(w, "Failed to determine affected rows", http.StatusInternalServerError)
+			return
+		}
+		if rowsAffected == 0 {
+			http.Error(w, "Provider is not linked to your account", http.StatusNotFound)
+			return
+		}
+
+		w.Write([]byte("Provider unlinked successfully"))
+	}
+}
+
+// provisionOIDCUser creates an account for a first-time external sign-in and links the identity.
+// Accounts created this way have no password until the user sets one through a password reset.
+func provisionOIDCUser(db *sql.DB, provider string, claims *oidcClaims) (string, error) {
+	email := strings.TrimSpace(claims.Email)
+	if email == "" || ValidateEmail(email) != nil {
+		return "", errEmailRequired
+	}
+
+	// An existing account must link the provider itself rather than being taken over by email
+	var exists bool
+	if err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE email = ?)`, email).Scan(&exists); err != nil {
+		return "", err
+	}
+	if exists {
+		return "", errEmailTaken
+	}
+
+	firstName, lastName := claims.GivenName, claims.FamilyName
+	if firstName == "" && lastName == "" && claims.Name != "" {
+		parts := strings.SplitN(claims.Name, " ", 2)
+		firstName = parts[0]
+		if len(parts) > 1 {
+			lastName = parts[1]
+		}
+	}
+
+	base := claims.PreferredUsername
+	if base == "" {
+		base = strings.Split(email, "@")[0]
+	}
+	nickname, err := GenerateNickname(db, base)
+	if err != nil {
+		return "", err
+	}
+
+	userID := uuid.New().String()
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO users (id, email, password, first_name, last_name, nickname, about_me, avatar, date_of_birth, email_verified)
+		VALUES (?, ?, '', ?, ?, ?, '', '', '', ?)
+	`, userID, email, firstName, lastName, nickname, claims.EmailVerified)
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO oauth_identities (id, user_id, provider, subject, email) VALUES (?, ?, ?, ?, ?)
+	`, uuid.New().String(), userID, provider, claims.Subject, email)
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	return userID, tx.Commit()
+}
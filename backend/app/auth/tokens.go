@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	purposePasswordReset     = "password_reset"
+	purposeEmailVerification = "email_verification"
+	purposeConfirmIdentity   = "confirm_identity"
+
+	passwordResetTTL     = time.Hour
+	emailVerificationTTL = 48 * time.Hour
+	confirmIdentityTTL   = time.Hour
+)
+
+var errInvalidToken = errors.New("invalid or expired token")
+
+// hashToken returns the SHA-256 of an emailed token; only the hash is stored
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// createAuthToken issues a single-use token for the given purpose, invalidating
+// any earlier unused token the user holds for the same purpose
+func createAuthToken(db *sql.DB, userID, purpose string, ttl time.Duration) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(`DELETE FROM auth_tokens WHERE user_id = ? AND purpose = ? AND used_at IS NULL`, userID, purpose)
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO auth_tokens (token_hash, user_id, purpose, expires_at)
+		VALUES (?, ?, ?, datetime('now', ?))
+	`, hashToken(token), userID, purpose, fmt.Sprintf("+%d seconds", int64(ttl.Seconds())))
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	return token, tx.Commit()
+}
+
+// consumeAuthToken marks a token as used and returns its owner. A token can only be redeemed once.
+func consumeAuthToken(db *sql.DB, token, purpose string) (string, error) {
+	var userID string
+	err := db.QueryRow(`
+		UPDATE auth_tokens SET used_at = CURRENT_TIMESTAMP
+		WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING user_id
+	`, hashToken(token), purpose).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", errInvalidToken
+	}
+	return userID, err
+}
+
+// appBaseURL returns the frontend origin, using APP_BASE_URL when set
+func appBaseURL() string {
+	if baseURL := os.Getenv("APP_BASE_URL"); baseURL != "" {
+		return strings.TrimSuffix(baseURL, "/")
+	}
+	return "http://localhost:3000"
+}
+
+// frontendURL builds a link to a frontend page carrying a token
+func frontendURL(path, token string) string {
+	return appBaseURL() + path + "?token=" + token
+}
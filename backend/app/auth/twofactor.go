@@ -0,0 +1,509 @@
+package auth
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"social-network/app/sessions"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	recoveryCodeCount      = 10
+	loginChallengeTTL      = 5 * time.Minute
+	maxLoginChallengeTries = 5
+)
+
+// normalizeRecoveryCode lower-cases a recovery code and strips separators
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+// replaceRecoveryCodes discards the user's recovery codes and returns a fresh set.
+// The plaintext codes are only ever shown in this response.
+func replaceRecoveryCodes(tx *sql.Tx, userID string) ([]string, error) {
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return nil, err
+	}
+
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 7)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(encoding.EncodeToString(buf))[:10]
+		code := raw[:5] + "-" + raw[5:]
+
+		_, err := tx.Exec(`INSERT INTO recovery_codes (id, user_id, code_hash) VALUES (?, ?, ?)`,
+			uuid.New().String(), userID, hashToken(normalizeRecoveryCode(code)))
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code for a user with 2FA enabled.
+// Accepted TOTP steps and recovery codes cannot be used again.
+func verifySecondFactor(db *sql.DB, userID, code, recoveryCode string) (bool, error) {
+	if recoveryCode != "" {
+		result, err := db.Exec(`
+			UPDATE recovery_codes SET used_at = CURRENT_TIMESTAMP
+			WHERE user_id = ? AND code_hash = ? AND used_at IS NULL
+		`, userID, hashToken(normalizeRecoveryCode(recoveryCode)))
+		if err != nil {
+			return false, err
+		}
+		rowsAffected, err := result.RowsAffected()
+		return rowsAffected == 1, err
+	}
+
+	var secret sql.NullString
+	var lastStep int64
+	err := db.QueryRow(`SELECT totp_secret, totp_last_step FROM users WHERE id = ? AND totp_enabled = 1`, userID).Scan(&secret, &lastStep)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	step, ok := validateTOTP(secret.String, code, lastStep)
+	if !ok {
+		return false, nil
+	}
+
+	// Only one request may claim a given step
+	result, err := db.Exec(`UPDATE users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?`, step, userID, step)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	return rowsAffected == 1, err
+}
+
+// createLoginChallenge stores a pending login that is completed by VerifyLoginHandler
+func createLoginChallenge(db *sql.DB, userID string, rememberMe bool) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	// Drop challenges nobody completed
+	if _, err := db.Exec(`DELETE FROM login_challenges WHERE expires_at <= CURRENT_TIMESTAMP`); err != nil {
+		return "", err
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO login_challenges (token_hash, user_id, remember_me, expires_at)
+		VALUES (?, ?, ?, datetime('now', ?))
+	`, hashToken(token), userID, rememberMe, fmt.Sprintf("+%d seconds", int64(loginChallengeTTL.Seconds())))
+	return token, err
+}
+
+// checkPasswordAndSecondFactor re-authenticates the logged-in user before sensitive 2FA changes
+func checkPasswordAndSecondFactor(w http.ResponseWriter, db *sql.DB, userID, password, code, recoveryCode string) bool {
+	var hashedPassword string
+	if err := db.QueryRow(`SELECT password FROM users WHERE id = ?`, userID).Scan(&hashedPassword); err != nil {
+		http.Error(w, "Failed to fetch user", http.StatusInternalServerError)
+		return false
+	}
+	if err := verifyPassword(db, userID, hashedPassword, password); err != nil {
+		writePasswordError(w, err, "Password is incorrect")
+		return false
+	}
+
+	ok, err := verifySecondFactor(db, userID, code, recoveryCode)
+	if err != nil {
+		http.Error(w, "Failed to verify code", http.StatusInternalServerError)
+		return false
+	}
+	if !ok {
+		http.Error(w, "Invalid two-factor code", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// ConfirmIdentity re-authenticates the logged-in user before destructive account changes. Accounts that
+// only sign in through social login have no password to check and must instead redeem a token emailed
+// by SendConfirmationEmail; accounts with 2FA must also pass a code.
+// It writes the error response and returns false when the check fails.
+func ConfirmIdentity(w http.ResponseWriter, db *sql.DB, userID, password, confirmationToken, code, recoveryCode string) bool {
+	var hashedPassword string
+	var totpEnabled bool
+	err := db.QueryRow(`SELECT password, COALESCE(totp_enabled, 0) FROM users WHERE id = ?`, userID).Scan(&hashedPassword, &totpEnabled)
+	if err != nil {
+		http.Error(w, "Failed to fetch user", http.StatusInternalServerError)
+		return false
+	}
+	if hashedPassword != "" {
+		if err := verifyPassword(db, userID, hashedPassword, password); err != nil {
+			writePasswordError(w, err, "Password is incorrect")
+			return false
+		}
+	}
+
+	if totpEnabled {
+		ok, err := verifySecondFactor(db, userID, code, recoveryCode)
+		if err != nil {
+			http.Error(w, "Failed to verify code", http.StatusInternalServerError)
+			return false
+		}
+		if !ok {
+			http.Error(w, "Invalid two-factor code", http.StatusUnauthorized)
+			return false
+		}
+	}
+
+	// The emailed token is only spent once every other check passed
+	if hashedPassword == "" {
+		tokenUserID, err := consumeAuthToken(db, confirmationToken, purposeConfirmIdentity)
+		if err == errInvalidToken || (err == nil && tokenUserID != userID) {
+			http.Error(w, "Invalid or expired confirmation token", http.StatusUnauthorized)
+			return false
+		} else if err != nil {
+			http.Error(w, "Failed to verify confirmation token", http.StatusInternalServerError)
+			return false
+		}
+	}
+	return true
+}
+
+// GetTwoFactorStatusHandler reports whether 2FA is enabled and how many recovery codes are left
+func GetTwoFactorStatusHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var enabled bool
+		var remaining int
+		err = db.QueryRow(`
+			SELECT totp_enabled,
+			       (SELECT COUNT(*) FROM recovery_codes WHERE user_id = users.id AND used_at IS NULL)
+			FROM users WHERE id = ?
+		`, userID).Scan(&enabled, &remaining)
+		if err != nil {
+			http.Error(w, "Failed to fetch two-factor status", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"enabled":                  enabled,
+			"recovery_codes_remaining": remaining,
+		})
+	}
+}
+
+// SetupTwoFactorHandler starts enrollment by generating a secret and its provisioning URI.
+// 2FA is not active until the user confirms a code with EnableTwoFactorHandler.
+func SetupTwoFactorHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var email string
+		var enabled bool
+		err = db.QueryRow(`SELECT email, totp_enabled FROM users WHERE id = ?`, userID).Scan(&email, &enabled)
+		if err != nil {
+			http.Error(w, "Failed to fetch user", http.StatusInternalServerError)
+			return
+		}
+		if enabled {
+			http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+			return
+		}
+
+		secret, err := generateTOTPSecret()
+		if err != nil {
+			http.Error(w, "Failed to generate secret", http.StatusInternalServerError)
+			return
+		}
+
+		if _, err := db.Exec(`UPDATE users SET totp_secret = ?, totp_last_step = 0 WHERE id = ?`, secret, userID); err != nil {
+			http.Error(w, "Failed to save secret", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"secret":           secret,
+			"provisioning_uri": totpProvisioningURI(secret, email),
+		})
+	}
+}
+
+// EnableTwoFactorHandler confirms enrollment with a code from the authenticator app
+// and returns the one-time recovery codes
+func EnableTwoFactorHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var request struct {
+			Code string `json:"code"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		var secret sql.NullString
+		var enabled bool
+		err = db.QueryRow(`SELECT totp_secret, totp_enabled FROM users WHERE id = ?`, userID).Scan(&secret, &enabled)
+		if err != nil {
+			http.Error(w, "Failed to fetch user", http.StatusInternalServerError)
+			return
+		}
+		if enabled {
+			http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+			return
+		}
+		if !secret.Valid || secret.String == "" {
+			http.Error(w, "Start two-factor setup first", http.StatusBadRequest)
+			return
+		}
+
+		step, ok := validateTOTP(secret.String, request.Code, 0)
+		if !ok {
+			http.Error(w, "Invalid two-factor code", http.StatusBadRequest)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+			return
+		}
+
+		_, err = tx.Exec(`UPDATE users SET totp_enabled = 1, totp_last_step = ? WHERE id = ?`, step, userID)
+		if err != nil {
+			tx.Rollback()
+			http.Error(w, "Failed to enable two-factor authentication", http.StatusInternalServerError)
+			return
+		}
+
+		codes, err := replaceRecoveryCodes(tx, userID)
+		if err != nil {
+			tx.Rollback()
+			http.Error(w, "Failed to generate recovery codes", http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":        "Two-factor authentication enabled successfully",
+			"recovery_codes": codes,
+		})
+	}
+}
+
+// DisableTwoFactorHandler turns 2FA off after the user re-enters their password and a current code
+func DisableTwoFactorHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var request struct {
+			Password     string `json:"password"`
+			Code         string `json:"code"`
+			RecoveryCode string `json:"recovery_code"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if !checkPasswordAndSecondFactor(w, db, userID, request.Password, request.Code, request.RecoveryCode) {
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+			return
+		}
+		for _, query := range []string{
+			`UPDATE users SET totp_enabled = 0, totp_secret = NULL, totp_last_step = 0 WHERE id = ?`,
+			`DELETE FROM recovery_codes WHERE user_id = ?`,
+			`DELETE FROM login_challenges WHERE user_id = ?`,
+		} {
+			if _, err := tx.Exec(query, userID); err != nil {
+				tx.Rollback()
+				http.Error(w, "Failed to disable two-factor authentication", http.StatusInternalServerError)
+				return
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
+		}
+
+		w.Write([]byte("Two-factor authentication disabled successfully"))
+	}
+}
+
+// RegenerateRecoveryCodesHandler replaces the user's recovery codes after re-authentication
+func RegenerateRecoveryCodesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var request struct {
+			Password string `json:"password"`
+			Code     string `json:"code"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if !checkPasswordAndSecondFactor(w, db, userID, request.Password, request.Code, "") {
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+			return
+		}
+		codes, err := replaceRecoveryCodes(tx, userID)
+		if err != nil {
+			tx.Rollback()
+			http.Error(w, "Failed to generate recovery codes", http.StatusInternalServerError)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":        "Recovery codes regenerated successfully",
+			"recovery_codes": codes,
+		})
+	}
+}
+
+// VerifyLoginHandler completes a two-factor login. The challenge token returned by LoginHandler
+// is exchanged for a session once a valid TOTP or recovery code is supplied.
+func VerifyLoginHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed. Only POST is allowed.", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var request struct {
+			ChallengeToken string `json:"challenge_token"`
+			Code           string `json:"code"`
+			RecoveryCode   string `json:"recovery_code"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if request.ChallengeToken == "" || (request.Code == "" && request.RecoveryCode == "") {
+			http.Error(w, "Missing challenge_token or code", http.StatusBadRequest)
+			return
+		}
+
+		challengeHash := hashToken(request.ChallengeToken)
+		var userID string
+		var rememberMe bool
+		err := db.QueryRow(`
+			SELECT user_id, remember_me FROM login_challenges
+			WHERE token_hash = ? AND expires_at > CURRENT_TIMESTAMP AND attempts < ?
+		`, challengeHash, maxLoginChallengeTries).Scan(&userID, &rememberMe)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Invalid or expired login challenge", http.StatusUnauthorized)
+			return
+		} else if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		ok, err := verifySecondFactor(db, userID, request.Code, request.RecoveryCode)
+		if err != nil {
+			http.Error(w, "Failed to verify code", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			db.Exec(`UPDATE login_challenges SET attempts = attempts + 1 WHERE token_hash = ?`, challengeHash)
+			http.Error(w, "Invalid two-factor code", http.StatusUnauthorized)
+			return
+		}
+
+		// The challenge is single-use
+		result, err := db.Exec(`DELETE FROM login_challenges WHERE token_hash = ?`, challengeHash)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			http.Error(w, "Invalid or expired login challenge", http.StatusUnauthorized)
+			return
+		}
+
+		startSession(w, r, db, userID, rememberMe)
+	}
+}
@@ -0,0 +1,21 @@
+package blocks
+
+import (
+	"database/sql"
+)
+
+// IsBlocked reports whether either user has blocked the other
+func IsBlocked(db *sql.DB, userID, otherUserID string) (bool, error) {
+	var blocked bool
+	err := db.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM blocks
+			WHERE (blocker_id = ? AND blocked_id = ?)
+			   OR (blocker_id = ? AND blocked_id = ?)
+		)
+	`, userID, otherUserID, otherUserID, userID).Scan(&blocked)
+	if err != nil {
+		return false, err
+	}
+	return blocked, nil
+}
@@ -0,0 +1,214 @@
+package blocks
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"social-network/app/sessions"
+
+	"github.com/google/uuid"
+)
+
+// BlockedUser represents a user on the logged-in user's block list
+type BlockedUser struct {
+	ID        string `json:"id"`
+	Nickname  string `json:"nickname"`
+	Avatar    string `json:"avatar"`
+	BlockedAt string `json:"blocked_at"`
+}
+
+// BlockUserHandler blocks a user and severs any follow relationship between the two users
+func BlockUserHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// The logged-in user ID from session
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var request struct {
+			BlockedID string `json:"blocked_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if request.BlockedID == "" {
+			http.Error(w, "Missing blocked_id", http.StatusBadRequest)
+			return
+		}
+		if userID == request.BlockedID {
+			http.Error(w, "You cannot block yourself", http.StatusBadRequest)
+			return
+		}
+
+		// Check if the blocked user exists
+		var blockedExists bool
+		err = db.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)`, request.BlockedID).Scan(&blockedExists)
+		if err != nil || !blockedExists {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		// Check if the block already exists
+		var alreadyBlocked bool
+		err = db.QueryRow(`
+			SELECT EXISTS(SELECT 1 FROM blocks WHERE blocker_id = ? AND blocked_id = ?)
+		`, userID, request.BlockedID).Scan(&alreadyBlocked)
+		if err != nil {
+			http.Error(w, "Failed to check block status", http.StatusInternalServerError)
+			return
+		}
+		if alreadyBlocked {
+			http.Error(w, "User already blocked", http.StatusBadRequest)
+			return
+		}
+
+		// Start a transaction so the block and the severed follow edges land together
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+			return
+		}
+
+		_, err = tx.Exec(`INSERT INTO blocks (id, blocker_id, blocked_id) VALUES (?, ?, ?)`,
+			uuid.New().String(), userID, request.BlockedID)
+		if err != nil {
+			tx.Rollback()
+			log.Printf("Error inserting block: %v", err)
+			http.Error(w, "Failed to block user", http.StatusInternalServerError)
+			return
+		}
+
+		// Remove follow relationships (accepted or pending) in both directions
+		_, err = tx.Exec(`
+			DELETE FROM followers
+			WHERE (follower_id = ? AND followed_id = ?)
+			   OR (follower_id = ? AND followed_id = ?)
+		`, userID, request.BlockedID, request.BlockedID, userID)
+		if err != nil {
+			tx.Rollback()
+			http.Error(w, "Failed to remove follow relationships", http.StatusInternalServerError)
+			return
+		}
+
+		// Remove any outstanding follow request notifications between the two users
+		_, err = tx.Exec(`
+			DELETE FROM notifications
+			WHERE type = 'follow_request'
+			  AND ((user_id = ? AND related_user_id = ?) OR (user_id = ? AND related_user_id = ?))
+		`, userID, request.BlockedID, request.BlockedID, userID)
+		if err != nil {
+			tx.Rollback()
+			http.Error(w, "Failed to remove follow request notifications", http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("User blocked successfully"))
+	}
+}
+
+// UnblockUserHandler removes a block created by the logged-in user
+func UnblockUserHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// The logged-in user ID from session
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var request struct {
+			BlockedID string `json:"blocked_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if request.BlockedID == "" {
+			http.Error(w, "Missing blocked_id", http.StatusBadRequest)
+			return
+		}
+
+		result, err := db.Exec(`DELETE FROM blocks WHERE blocker_id = ? AND blocked_id = ?`, userID, request.BlockedID)
+		if err != nil {
+			http.Error(w, "Failed to unblock user", http.StatusInternalServerError)
+			return
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			http.Error(w, "Failed to determine affected rows", http.StatusInternalServerError)
+			return
+		}
+		if rowsAffected == 0 {
+			http.Error(w, "You have not blocked this user", http.StatusBadRequest)
+			return
+		}
+
+		w.Write([]byte("User unblocked successfully"))
+	}
+}
+
+// GetBlockedUsersHandler fetches the users blocked by the logged-in user
+func GetBlockedUsersHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Get the logged-in user ID from the session
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		rows, err := db.Query(`
+			SELECT users.id, users.nickname, users.avatar, blocks.created_at
+			FROM blocks
+			JOIN users ON blocks.blocked_id = users.id
+			WHERE blocks.blocker_id = ?
+			ORDER BY blocks.created_at DESC
+		`, userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch blocked users", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		var blocked []BlockedUser
+		for rows.Next() {
+			var user BlockedUser
+			if err := rows.Scan(&user.ID, &user.Nickname, &user.Avatar, &user.BlockedAt); err != nil {
+				http.Error(w, "Failed to parse blocked users", http.StatusInternalServerError)
+				return
+			}
+			blocked = append(blocked, user)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(blocked)
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"social-network/app/blocks"
+	"social-network/app/mentions"
+	"social-network/app/ratelimit"
 	"social-network/app/sessions"
 	"strings"
 	"time"
@@ -25,6 +28,7 @@ type PrivateMessage struct {
 	Message    string `json:"message"`
 	CreatedAt  string `json:"created_at"`
 	Read       bool   `json:"read"`
+	Entities   []mentions.Entity `json:"entities,omitempty"`
 }
 
 // GetPrivateChatHistoryHandler retrieves the chat history between the logged-in user and another user.
@@ -37,7 +41,7 @@ func GetPrivateChatHistoryHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		// Get the logged-in user's ID.
-		userID, err := sessions.GetUserIDFromSession(r)
+		userID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
@@ -50,15 +54,22 @@ func GetPrivateChatHistoryHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Query for messages between the two users.
+		// Query for messages between the two users. While either of them has blocked the other the
+		// history is withheld too, not only new messages.
 		query := `
 			SELECT id, sender_id, receiver_id, message, created_at, read
 			FROM private_chat_messages
-			WHERE (sender_id = ? AND receiver_id = ?)
-			   OR (sender_id = ? AND receiver_id = ?)
+			WHERE ((sender_id = ?1 AND receiver_id = ?2)
+			   OR (sender_id = ?2 AND receiver_id = ?1))
+			  AND hidden = 0
+			  AND NOT EXISTS(
+			      SELECT 1 FROM blocks
+			      WHERE (blocker_id = ?1 AND blocked_id = ?2)
+			         OR (blocker_id = ?2 AND blocked_id = ?1)
+			  )
 			ORDER BY created_at ASC
 		`
-		rows, err := db.Query(query, userID, otherUserID, otherUserID, userID)
+		rows, err := db.Query(query, userID, otherUserID)
 		if err != nil {
 			http.Error(w, "Failed to fetch messages", http.StatusInternalServerError)
 			return
@@ -66,7 +77,7 @@ func GetPrivateChatHistoryHandler(db *sql.DB) http.HandlerFunc {
 		defer rows.Close()
 
 		// Collect messages.
-		var messages []PrivateMessage
+		messages := []PrivateMessage{}
 		for rows.Next() {
 			var msg PrivateMessage
 			if err := rows.Scan(&msg.ID, &msg.SenderID, &msg.ReceiverID, &msg.Message, &msg.CreatedAt, &msg.Read); err != nil {
@@ -76,6 +87,20 @@ func GetPrivateChatHistoryHandler(db *sql.DB) http.HandlerFunc {
 			messages = append(messages, msg)
 		}
 
+		// Attach the mentions of each message.
+		ids := make([]string, len(messages))
+		for i, msg := range messages {
+			ids[i] = msg.ID
+		}
+		found, err := mentions.Load(db, "private_chat_message", ids)
+		if err != nil {
+			http.Error(w, "Failed to fetch mentions", http.StatusInternalServerError)
+			return
+		}
+		for i := range messages {
+			messages[i].Entities = found[messages[i].ID]
+		}
+
 		// Return the messages as JSON.
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(messages)
@@ -92,12 +117,16 @@ type ChatMessage struct {
 	Type      string `json:"type"`
 	CreatedAt string `json:"created_at"`
     SenderName string `json:"sender_name"`
+	Entities   []mentions.Entity `json:"entities,omitempty"`
 }
 
 // -----------------------------
 // WebSocket Upgrade and Tracking
 // -----------------------------
 
+// messageLimiter caps how many chat messages a user can send per second across all of their sockets
+var messageLimiter = ratelimit.NewLimiter(5, 10)
+
 var upgrader = websocket.Upgrader{
 	// Allow connections from any origin (adjust as needed for production)
 	CheckOrigin: func(r *http.Request) bool {
@@ -113,6 +142,13 @@ var upgrader = websocket.Upgrader{
 
 func PrivateChatHandler(db *sql.DB) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
+        // Retrieve user ID before upgrading
+        userID, err := sessions.UserIDFromContext(r.Context())
+        if err != nil {
+            http.Error(w, "Unauthorized", http.StatusUnauthorized)
+            return
+        }
+
         // Upgrade connection
         conn, err := upgrader.Upgrade(w, r, nil)
         if err != nil {
@@ -121,14 +157,6 @@ func PrivateChatHandler(db *sql.DB) http.HandlerFunc {
         defer func() {
             conn.Close()
         }()
-
-        // Retrieve user ID
-       	userID, err := sessions.GetUserIDFromSession(r)
-
-        if err != nil {
-            conn.WriteMessage(websocket.TextMessage, []byte("Unauthorized"))
-            return
-        }
         AddChatClient(userID, conn, db)
         if err := MarkUserOnline(db, userID); err != nil {
         }
@@ -170,15 +198,37 @@ func PrivateChatHandler(db *sql.DB) http.HandlerFunc {
             if err := json.Unmarshal(msgBytes, &msg); err != nil {
                 continue
             }
+
+            // Throttle senders; excess typing events are dropped silently
+            if ok, _ := messageLimiter.Allow(userID); !ok {
+                if msg.Type != "typing" {
+                    errorMsg := map[string]string{"error": "You are sending messages too fast."}
+                    errorBytes, _ := json.Marshal(errorMsg)
+                    conn.WriteMessage(websocket.TextMessage, errorBytes)
+                }
+                continue
+            }
             // Override sender fields
             msg.SenderID = userID
             msg.ID = uuid.New().String()
             msg.CreatedAt = time.Now().Format(time.RFC3339)
+            msg.Entities = nil
             err = db.QueryRow("SELECT nickname FROM users WHERE id = ?", msg.SenderID).Scan(&msg.SenderName)
             if err != nil {
                 msg.SenderName = userID
             }
 
+            // Drop anything sent between users who have blocked one another
+            blocked, err := blocks.IsBlocked(db, userID, msg.ReceiverID)
+            if err != nil || blocked {
+                if msg.Type != "typing" {
+                    errorMsg := map[string]string{"error": "Chat not permitted with this user."}
+                    errorBytes, _ := json.Marshal(errorMsg)
+                    conn.WriteMessage(websocket.TextMessage, errorBytes)
+                }
+                continue
+            }
+
             // Handle typing notifications
             if msg.Type == "typing" {
                 if client, ok := GetChatClient(msg.ReceiverID); ok {
@@ -224,6 +274,13 @@ func PrivateChatHandler(db *sql.DB) http.HandlerFunc {
                 VALUES (?, ?, ?, ?, ?)
             `, msg.ID, userID, msg.ReceiverID, msg.Message, msg.CreatedAt)
             if err != nil {
+                log.Println("Failed to save message:", err)
+            } else {
+                // Link and notify the users mentioned in the message
+                msg.Entities, err = mentions.Process(db, mentions.Content{Type: "private_chat_message", ID: msg.ID, AuthorID: userID}, msg.Message)
+                if err != nil {
+                    log.Println("Failed to process mentions:", err)
+                }
             }
 
             // Forward message to recipient if connected
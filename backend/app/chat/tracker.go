@@ -173,16 +173,14 @@ const (
 
 func OnlineUsersSocketHandler(db *sql.DB) http.HandlerFunc {
     return func(w http.ResponseWriter, r *http.Request) {
-        conn, err := upgrader.Upgrade(w, r, nil)
+        // Retrieve user ID before upgrading.
+        userID, err := sessions.UserIDFromContext(r.Context())
         if err != nil {
-            http.Error(w, "Failed to upgrade connection", http.StatusInternalServerError)
+            http.Error(w, "Unauthorized", http.StatusUnauthorized)
             return
         }
-        // Retrieve user ID from session.
-        userID, err := sessions.GetUserIDFromSession(r)
+        conn, err := upgrader.Upgrade(w, r, nil)
         if err != nil {
-            conn.WriteMessage(websocket.TextMessage, []byte("Unauthorized"))
-            conn.Close()
             return
         }
         // Set initial read deadline and define pong handler.
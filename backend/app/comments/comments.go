@@ -4,9 +4,12 @@ import (
 	"database/sql"
 	"encoding/json"
 	"io"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"social-network/app/blocks"
+	"social-network/app/mentions"
 	"social-network/app/notifications"
 	"social-network/app/sessions"
 	"strings"
@@ -41,7 +44,7 @@ func AddCommentHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		// Retrieve user ID from session
-		userID, err := sessions.GetUserIDFromSession(r)
+		userID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
 			return
@@ -62,6 +65,25 @@ func AddCommentHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		// Fetch the owner of the post
+		var postOwnerID string
+		err = db.QueryRow(`SELECT user_id FROM posts WHERE id = ?`, postID).Scan(&postOwnerID)
+		if err != nil {
+			http.Error(w, "Failed to retrieve post owner", http.StatusInternalServerError)
+			return
+		}
+
+		// Blocked users cannot comment on each other's posts
+		blocked, err := blocks.IsBlocked(db, userID, postOwnerID)
+		if err != nil {
+			http.Error(w, "Failed to check block status", http.StatusInternalServerError)
+			return
+		}
+		if blocked {
+			http.Error(w, "You cannot comment on this post", http.StatusForbidden)
+			return
+		}
+
 		// Handle file upload (optional)
 		var imageURL string
 		file, fileHeader, err := r.FormFile("file")
@@ -107,14 +129,6 @@ func AddCommentHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Fetch the owner of the post
-		var postOwnerID string
-		err = db.QueryRow(`SELECT user_id FROM posts WHERE id = ?`, postID).Scan(&postOwnerID)
-		if err != nil {
-			http.Error(w, "Failed to retrieve post owner", http.StatusInternalServerError)
-			return
-		}
-
 		// If the commenter is not the post owner, create a notification.
 		if userID != postOwnerID {
 			// Fetch the commenter's nickname
@@ -135,8 +149,20 @@ func AddCommentHandler(db *sql.DB) http.HandlerFunc {
 			}
 		}
 
+		// Link and notify the users mentioned in the comment
+		entities, err := mentions.Process(db, mentions.Content{Type: "comment", ID: commentID, AuthorID: userID, PostID: postID}, content)
+		if err != nil {
+			log.Printf("Failed to process mentions for comment %s: %v", commentID, err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
-		w.Write([]byte("Comment added successfully"))
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":    "Comment added successfully",
+			"comment_id": commentID,
+			"content":    content,
+			"entities":   entities,
+		})
 	}
 }
 
@@ -149,7 +175,7 @@ func DeleteCommentHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		// Retrieve user ID from session
-		userID, err := sessions.GetUserIDFromSession(r)
+		userID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
 			return
@@ -179,13 +205,27 @@ func DeleteCommentHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Delete the comment from the database
-		query := `DELETE FROM comments WHERE id = ?`
-		_, err = db.Exec(query, commentID)
+		// Delete the comment and its mentions together
+		queries := []string{
+			`DELETE FROM mentions WHERE content_type = 'comment' AND content_id = ?`,
+			`DELETE FROM comments WHERE id = ?`,
+		}
+		tx, err := db.Begin()
 		if err != nil {
 			http.Error(w, "Failed to delete comment", http.StatusInternalServerError)
 			return
 		}
+		defer tx.Rollback()
+		for _, query := range queries {
+			if _, err := tx.Exec(query, commentID); err != nil {
+				http.Error(w, "Failed to delete comment", http.StatusInternalServerError)
+				return
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to delete comment", http.StatusInternalServerError)
+			return
+		}
 
 		w.Write([]byte("Comment deleted successfully"))
 	}
@@ -205,14 +245,25 @@ func GetCommentsByPostHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		// Comments from accounts with a block either way are left out. Comments from accounts muted
+		// by the viewer are hidden too unless show_muted=true is passed
+		viewerID, _ := sessions.UserIDFromContext(r.Context())
+		showMuted := r.URL.Query().Get("show_muted") == "true"
+
 		// Query to fetch comments along with user's nickname and avatar
 		rows, err := db.Query(`
 			SELECT c.id, c.post_id, c.user_id, u.nickname, u.avatar, c.content, c.image_url, c.created_at
 			FROM comments c
 			JOIN users u ON c.user_id = u.id
-			WHERE c.post_id = ?
+			WHERE c.post_id = ?1 AND c.hidden = 0
+			AND NOT EXISTS(
+			    SELECT 1 FROM blocks
+			    WHERE (blocker_id = c.user_id AND blocked_id = ?3)
+			       OR (blocker_id = ?3 AND blocked_id = c.user_id)
+			)
+			AND (?2 OR NOT EXISTS(SELECT 1 FROM muted_users WHERE user_id = ?3 AND muted_user_id = c.user_id))
 			ORDER BY c.created_at ASC
-		`, postID)
+		`, postID, showMuted, viewerID)
 		if err != nil {
 			http.Error(w, "Failed to fetch comments", http.StatusInternalServerError)
 			return
@@ -229,6 +280,7 @@ func GetCommentsByPostHandler(db *sql.DB) http.HandlerFunc {
 			Content   string `json:"content"`
 			ImageURL  string `json:"image_url,omitempty"`
 			CreatedAt string `json:"created_at"`
+			Entities  []mentions.Entity `json:"entities,omitempty"`
 		}
 
 		var comments []CommentResponse
@@ -241,6 +293,19 @@ func GetCommentsByPostHandler(db *sql.DB) http.HandlerFunc {
 			comments = append(comments, comment)
 		}
 
+		ids := make([]string, len(comments))
+		for i, comment := range comments {
+			ids[i] = comment.ID
+		}
+		found, err := mentions.Load(db, "comment", ids)
+		if err != nil {
+			http.Error(w, "Failed to fetch mentions", http.StatusInternalServerError)
+			return
+		}
+		for i := range comments {
+			comments[i].Entities = found[comments[i].ID]
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(comments)
 	}
@@ -0,0 +1,9 @@
+CREATE TABLE blocks (
+    id TEXT PRIMARY KEY,              -- UUID for the block
+    blocker_id TEXT NOT NULL,         -- User who created the block
+    blocked_id TEXT NOT NULL,         -- User being blocked
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(blocker_id, blocked_id),
+    FOREIGN KEY (blocker_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (blocked_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS muted_keywords;
+DROP TABLE IF EXISTS muted_users;
@@ -0,0 +1,18 @@
+CREATE TABLE muted_users (
+    id TEXT PRIMARY KEY,              -- UUID for the mute
+    user_id TEXT NOT NULL,            -- User who muted the account
+    muted_user_id TEXT NOT NULL,      -- Account whose posts and comments are hidden
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, muted_user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (muted_user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE muted_keywords (
+    id TEXT PRIMARY KEY,              -- UUID for the muted keyword
+    user_id TEXT NOT NULL,            -- User who muted the keyword
+    keyword TEXT NOT NULL,            -- Lower-cased keyword or phrase
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, keyword),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
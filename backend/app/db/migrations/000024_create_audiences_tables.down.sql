@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS post_audiences;
+DROP TABLE IF EXISTS audience_members;
+DROP TABLE IF EXISTS audiences;
@@ -0,0 +1,25 @@
+CREATE TABLE audiences (
+    id TEXT PRIMARY KEY,              -- UUID for the audience list
+    owner_id TEXT NOT NULL,           -- User who manages the list
+    name TEXT NOT NULL,               -- Display name, e.g. "close friends"
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(owner_id, name),
+    FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE audience_members (
+    audience_id TEXT NOT NULL,        -- The audience list
+    user_id TEXT NOT NULL,            -- A user included in the list
+    added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (audience_id, user_id),
+    FOREIGN KEY (audience_id) REFERENCES audiences(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE post_audiences (
+    post_id TEXT NOT NULL,            -- A private post
+    audience_id TEXT NOT NULL,        -- An audience list the post is shared with
+    PRIMARY KEY (post_id, audience_id),
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (audience_id) REFERENCES audiences(id) ON DELETE CASCADE
+);
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS moderation_actions;
+DROP INDEX IF EXISTS idx_reports_status;
+DROP TABLE IF EXISTS reports;
+ALTER TABLE private_chat_messages DROP COLUMN hidden;
+ALTER TABLE group_chat_messages DROP COLUMN hidden;
+ALTER TABLE group_post_comments DROP COLUMN hidden;
+ALTER TABLE group_posts DROP COLUMN hidden;
+ALTER TABLE comments DROP COLUMN hidden;
+ALTER TABLE posts DROP COLUMN hidden;
+ALTER TABLE users DROP COLUMN suspended;
@@ -0,0 +1,40 @@
+ALTER TABLE users ADD COLUMN suspended INTEGER DEFAULT 0;
+
+-- Content hidden by a moderator is excluded from every read
+ALTER TABLE posts ADD COLUMN hidden INTEGER DEFAULT 0;
+ALTER TABLE comments ADD COLUMN hidden INTEGER DEFAULT 0;
+ALTER TABLE group_posts ADD COLUMN hidden INTEGER DEFAULT 0;
+ALTER TABLE group_post_comments ADD COLUMN hidden INTEGER DEFAULT 0;
+ALTER TABLE group_chat_messages ADD COLUMN hidden INTEGER DEFAULT 0;
+ALTER TABLE private_chat_messages ADD COLUMN hidden INTEGER DEFAULT 0;
+
+CREATE TABLE reports (
+    id TEXT PRIMARY KEY,              -- UUID for the report
+    reporter_id TEXT NOT NULL,        -- User who filed the report
+    content_type TEXT NOT NULL CHECK(content_type IN ('post', 'comment', 'group_post', 'group_post_comment', 'group_chat_message', 'private_chat_message', 'user')),
+    content_id TEXT NOT NULL,         -- ID of the reported row (the user ID for 'user' reports)
+    reported_user_id TEXT NOT NULL,   -- Author of the reported content
+    reason TEXT NOT NULL CHECK(reason IN ('spam', 'harassment', 'hate_speech', 'violence', 'nudity', 'misinformation', 'impersonation', 'other')),
+    details TEXT,                     -- Optional free-text explanation from the reporter
+    status TEXT NOT NULL DEFAULT 'open' CHECK(status IN ('open', 'actioned', 'dismissed')),
+    resolved_by TEXT,                 -- Moderator who closed the report
+    resolved_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (reporter_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (reported_user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_reports_status ON reports(status, created_at);
+
+CREATE TABLE moderation_actions (
+    id TEXT PRIMARY KEY,              -- UUID for the audit entry
+    moderator_id TEXT NOT NULL,       -- Moderator who took the action
+    action TEXT NOT NULL,             -- e.g. hide_content, unhide_content, suspend_user, dismiss_report
+    content_type TEXT,                -- Type of the affected content, if any
+    content_id TEXT,                  -- ID of the affected content, if any
+    target_user_id TEXT,              -- User affected by the action
+    report_id TEXT,                   -- Report that led to the action, if any
+    note TEXT,                        -- Moderator's note
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (moderator_id) REFERENCES users(id)
+);
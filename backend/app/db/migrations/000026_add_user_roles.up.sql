@@ -0,0 +1,2 @@
+-- Global role: 'user', 'moderator' or 'admin'
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user' CHECK(role IN ('user', 'moderator', 'admin'));
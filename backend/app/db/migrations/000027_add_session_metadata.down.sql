@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_active_sessions_user_id;
+DROP INDEX IF EXISTS idx_active_sessions_public_id;
+ALTER TABLE active_sessions DROP COLUMN last_used_at;
+ALTER TABLE active_sessions DROP COLUMN ip_address;
+ALTER TABLE active_sessions DROP COLUMN user_agent;
+ALTER TABLE active_sessions DROP COLUMN public_id;
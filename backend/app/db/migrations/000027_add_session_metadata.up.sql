@@ -0,0 +1,12 @@
+-- Migration to add device metadata to `active_sessions`
+ALTER TABLE active_sessions ADD COLUMN public_id TEXT;         -- Non-secret identifier used to list and revoke sessions
+ALTER TABLE active_sessions ADD COLUMN user_agent TEXT DEFAULT '';
+ALTER TABLE active_sessions ADD COLUMN ip_address TEXT DEFAULT '';
+ALTER TABLE active_sessions ADD COLUMN last_used_at DATETIME;
+
+-- Backfill existing sessions
+UPDATE active_sessions SET public_id = lower(hex(randomblob(16))) WHERE public_id IS NULL;
+UPDATE active_sessions SET last_used_at = created_at WHERE last_used_at IS NULL;
+
+CREATE UNIQUE INDEX idx_active_sessions_public_id ON active_sessions(public_id);
+CREATE INDEX idx_active_sessions_user_id ON active_sessions(user_id);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_active_sessions_expires_at;
+ALTER TABLE active_sessions DROP COLUMN remember_me;
@@ -0,0 +1,8 @@
+-- Migration to store hashed session IDs and support long-lived "remember me" sessions
+
+-- Existing sessions hold raw IDs that cannot be hashed in SQL, so everyone signs in again
+DELETE FROM active_sessions;
+
+ALTER TABLE active_sessions ADD COLUMN remember_me INTEGER DEFAULT 0; -- Selects the longer sliding expiry window
+
+CREATE INDEX idx_active_sessions_expires_at ON active_sessions(expires_at);
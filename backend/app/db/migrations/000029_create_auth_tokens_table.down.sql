@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_auth_tokens_user_purpose;
+DROP TABLE IF EXISTS auth_tokens;
+ALTER TABLE users DROP COLUMN email_verified;
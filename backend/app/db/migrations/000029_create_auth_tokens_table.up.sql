@@ -0,0 +1,15 @@
+-- Migration to support email verification and password reset
+
+ALTER TABLE users ADD COLUMN email_verified INTEGER DEFAULT 0; -- 1 once the user confirmed their email address
+
+CREATE TABLE auth_tokens (
+    token_hash TEXT PRIMARY KEY,          -- SHA-256 of the token sent by email
+    user_id TEXT NOT NULL,                -- User the token was issued to
+    purpose TEXT NOT NULL CHECK(purpose IN ('password_reset', 'email_verification')),
+    expires_at DATETIME NOT NULL,         -- When the token stops being accepted
+    used_at DATETIME,                     -- Set once the token has been redeemed
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_auth_tokens_user_purpose ON auth_tokens(user_id, purpose);
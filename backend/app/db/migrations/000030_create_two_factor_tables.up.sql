@@ -0,0 +1,27 @@
+-- Migration to support TOTP two-factor authentication
+
+ALTER TABLE users ADD COLUMN totp_secret TEXT;                 -- Base32 TOTP secret, set during enrollment
+ALTER TABLE users ADD COLUMN totp_enabled INTEGER DEFAULT 0;   -- 1 once enrollment was confirmed with a valid code
+ALTER TABLE users ADD COLUMN totp_last_step INTEGER DEFAULT 0; -- Last accepted time step, prevents code replay
+
+CREATE TABLE recovery_codes (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    code_hash TEXT NOT NULL,              -- SHA-256 of the recovery code
+    used_at DATETIME,                     -- Set once the code has been redeemed
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_recovery_codes_user_id ON recovery_codes(user_id);
+
+-- Pending logins waiting for the second factor
+CREATE TABLE login_challenges (
+    token_hash TEXT PRIMARY KEY,          -- SHA-256 of the challenge token returned by /login
+    user_id TEXT NOT NULL,
+    remember_me INTEGER DEFAULT 0,        -- Carried over to the session created after verification
+    attempts INTEGER DEFAULT 0,           -- Failed codes entered for this challenge
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
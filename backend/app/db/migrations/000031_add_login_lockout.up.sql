@@ -0,0 +1,3 @@
+-- Migration to lock accounts after repeated failed password attempts
+ALTER TABLE users ADD COLUMN failed_login_attempts INTEGER DEFAULT 0; -- Consecutive wrong passwords
+ALTER TABLE users ADD COLUMN locked_until DATETIME;                   -- Password checks are refused until this time
@@ -0,0 +1,25 @@
+-- Migration to support signing in with external OpenID Connect providers
+
+CREATE TABLE oauth_identities (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,                -- Local account the identity signs in to
+    provider TEXT NOT NULL,               -- Configured provider name, e.g. "google"
+    subject TEXT NOT NULL,                -- The provider's stable user identifier (sub claim)
+    email TEXT,                           -- Email reported by the provider when linked
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE(provider, subject),
+    UNIQUE(user_id, provider)
+);
+
+-- Pending authorization requests, consumed by the callback
+CREATE TABLE oauth_states (
+    state TEXT PRIMARY KEY,
+    provider TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,          -- PKCE verifier sent with the token request
+    nonce TEXT NOT NULL,                  -- Must match the nonce claim of the ID token
+    link_user_id TEXT,                    -- Set when an existing user is linking a provider
+    remember_me INTEGER DEFAULT 0,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
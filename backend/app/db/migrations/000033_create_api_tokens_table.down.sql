@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_api_tokens_pair_id;
+DROP INDEX IF EXISTS idx_api_tokens_user_id;
+DROP TABLE IF EXISTS api_tokens;
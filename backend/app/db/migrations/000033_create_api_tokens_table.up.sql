@@ -0,0 +1,18 @@
+-- Migration to support bearer token authentication for non-browser clients
+
+CREATE TABLE api_tokens (
+    id TEXT PRIMARY KEY,                  -- Public identifier used to list and revoke tokens
+    user_id TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,      -- SHA-256 of the token; the token itself is never stored
+    kind TEXT NOT NULL CHECK(kind IN ('personal', 'access', 'refresh')),
+    name TEXT DEFAULT '',                 -- Label chosen for personal access tokens
+    scopes TEXT NOT NULL,                 -- Space-separated subset of: read write chat
+    pair_id TEXT,                         -- Shared by an access token and the refresh token issued with it
+    expires_at DATETIME,                  -- NULL for personal tokens that never expire
+    last_used_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_api_tokens_user_id ON api_tokens(user_id);
+CREATE INDEX idx_api_tokens_pair_id ON api_tokens(pair_id);
@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN deletion_scheduled_at DATETIME; -- The account is purged after this time; NULL when no deletion is pending
+
+CREATE INDEX idx_users_deletion_scheduled_at ON users(deletion_scheduled_at);
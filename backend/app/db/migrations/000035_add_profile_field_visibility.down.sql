@@ -0,0 +1,4 @@
+ALTER TABLE users DROP COLUMN about_visibility;
+ALTER TABLE users DROP COLUMN name_visibility;
+ALTER TABLE users DROP COLUMN birthday_visibility;
+ALTER TABLE users DROP COLUMN email_visibility;
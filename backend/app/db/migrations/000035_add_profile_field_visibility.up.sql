@@ -0,0 +1,6 @@
+-- Migration to let users choose who sees each profile field: 'public', 'followers' or 'only_me'
+-- Everything starts public, which is what profiles showed before
+ALTER TABLE users ADD COLUMN email_visibility TEXT NOT NULL DEFAULT 'public' CHECK (email_visibility IN ('public', 'followers', 'only_me'));
+ALTER TABLE users ADD COLUMN birthday_visibility TEXT NOT NULL DEFAULT 'public' CHECK (birthday_visibility IN ('public', 'followers', 'only_me'));
+ALTER TABLE users ADD COLUMN name_visibility TEXT NOT NULL DEFAULT 'public' CHECK (name_visibility IN ('public', 'followers', 'only_me')); -- First and last name
+ALTER TABLE users ADD COLUMN about_visibility TEXT NOT NULL DEFAULT 'public' CHECK (about_visibility IN ('public', 'followers', 'only_me'));
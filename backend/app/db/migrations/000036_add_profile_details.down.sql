@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_profile_links_user_id;
+DROP TABLE IF EXISTS profile_links;
+
+ALTER TABLE users DROP COLUMN pinned_post_id;
+ALTER TABLE users DROP COLUMN pronouns;
+ALTER TABLE users DROP COLUMN location;
+ALTER TABLE users DROP COLUMN cover_image;
@@ -0,0 +1,17 @@
+-- Migration to add a cover image, location, pronouns, a pinned post and website links to profiles
+ALTER TABLE users ADD COLUMN cover_image TEXT;    -- File name under uploads/
+ALTER TABLE users ADD COLUMN location TEXT;
+ALTER TABLE users ADD COLUMN pronouns TEXT;
+ALTER TABLE users ADD COLUMN pinned_post_id TEXT; -- One of the user's own posts; ignored once the post is gone
+
+CREATE TABLE profile_links (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    label TEXT,                            -- Optional text shown instead of the URL
+    url TEXT NOT NULL,
+    position INTEGER NOT NULL DEFAULT 0,   -- Display order on the profile
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_profile_links_user_id ON profile_links(user_id, position);
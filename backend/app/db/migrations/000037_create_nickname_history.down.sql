@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_nickname_history_user_id;
+DROP INDEX IF EXISTS idx_nickname_history_nickname;
+DROP TABLE IF EXISTS nickname_history;
@@ -0,0 +1,12 @@
+-- Migration to remember past nicknames so an old @handle keeps pointing at its account for a while
+CREATE TABLE nickname_history (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    nickname TEXT NOT NULL,                         -- The nickname that was given up
+    changed_at DATETIME DEFAULT CURRENT_TIMESTAMP,  -- When the user switched away from it
+    reserved_until DATETIME NOT NULL,               -- Until then it resolves to user_id and nobody else can take it
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_nickname_history_nickname ON nickname_history(nickname, reserved_until);
+CREATE INDEX idx_nickname_history_user_id ON nickname_history(user_id, changed_at);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_mentions_mentioned_user_id;
+DROP INDEX IF EXISTS idx_mentions_content;
+DROP TABLE IF EXISTS mentions;
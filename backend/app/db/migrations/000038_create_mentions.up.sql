@@ -0,0 +1,17 @@
+-- Migration to store @mentions found in posts, comments and chat messages, with their place in the text
+CREATE TABLE mentions (
+    id TEXT PRIMARY KEY,
+    content_type TEXT NOT NULL CHECK(content_type IN ('post', 'comment', 'group_post', 'group_post_comment', 'group_chat_message', 'private_chat_message')),
+    content_id TEXT NOT NULL,           -- ID of the row the mention was written in
+    author_id TEXT NOT NULL,            -- User who wrote the mention
+    mentioned_user_id TEXT NOT NULL,    -- User the @handle resolved to when it was written
+    nickname TEXT NOT NULL,             -- The handle as written, without the @
+    start_offset INTEGER NOT NULL,      -- Position of the @ in the text, in characters
+    length INTEGER NOT NULL,            -- Length of the @handle, in characters
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (author_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (mentioned_user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_mentions_content ON mentions(content_type, content_id);
+CREATE INDEX idx_mentions_mentioned_user_id ON mentions(mentioned_user_id);
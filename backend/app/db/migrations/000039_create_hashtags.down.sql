@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_hashtags_created_at;
+DROP INDEX IF EXISTS idx_hashtags_tag;
+DROP TABLE IF EXISTS hashtags;
@@ -0,0 +1,12 @@
+-- Migration to index the #hashtags used in posts and group posts
+CREATE TABLE hashtags (
+    id TEXT PRIMARY KEY,
+    content_type TEXT NOT NULL CHECK(content_type IN ('post', 'group_post')),
+    content_id TEXT NOT NULL,           -- ID of the post the tag was used in
+    tag TEXT NOT NULL,                  -- Lowercased, without the #
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (content_type, content_id, tag)
+);
+
+CREATE INDEX idx_hashtags_tag ON hashtags(tag, created_at);
+CREATE INDEX idx_hashtags_created_at ON hashtags(created_at);
@@ -0,0 +1,18 @@
+CREATE TABLE auth_tokens_old (
+    token_hash TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    purpose TEXT NOT NULL CHECK(purpose IN ('password_reset', 'email_verification')),
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO auth_tokens_old SELECT token_hash, user_id, purpose, expires_at, used_at, created_at
+FROM auth_tokens WHERE purpose != 'confirm_identity';
+
+DROP INDEX IF EXISTS idx_auth_tokens_user_purpose;
+DROP TABLE auth_tokens;
+ALTER TABLE auth_tokens_old RENAME TO auth_tokens;
+
+CREATE INDEX idx_auth_tokens_user_purpose ON auth_tokens(user_id, purpose);
@@ -0,0 +1,20 @@
+-- Accounts without a password confirm destructive changes through an emailed token.
+-- SQLite cannot change a CHECK constraint, so auth_tokens is rebuilt with the new purpose.
+
+CREATE TABLE auth_tokens_new (
+    token_hash TEXT PRIMARY KEY,          -- SHA-256 of the token sent by email
+    user_id TEXT NOT NULL,                -- User the token was issued to
+    purpose TEXT NOT NULL CHECK(purpose IN ('password_reset', 'email_verification', 'confirm_identity')),
+    expires_at DATETIME NOT NULL,         -- When the token stops being accepted
+    used_at DATETIME,                     -- Set once the token has been redeemed
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO auth_tokens_new SELECT token_hash, user_id, purpose, expires_at, used_at, created_at FROM auth_tokens;
+
+DROP INDEX IF EXISTS idx_auth_tokens_user_purpose;
+DROP TABLE auth_tokens;
+ALTER TABLE auth_tokens_new RENAME TO auth_tokens;
+
+CREATE INDEX idx_auth_tokens_user_purpose ON auth_tokens(user_id, purpose);
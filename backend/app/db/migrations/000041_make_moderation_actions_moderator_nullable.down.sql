@@ -0,0 +1,18 @@
+CREATE TABLE moderation_actions_old (
+    id TEXT PRIMARY KEY,
+    moderator_id TEXT NOT NULL,
+    action TEXT NOT NULL,
+    content_type TEXT,
+    content_id TEXT,
+    target_user_id TEXT,
+    report_id TEXT,
+    note TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (moderator_id) REFERENCES users(id)
+);
+
+INSERT INTO moderation_actions_old SELECT id, moderator_id, action, content_type, content_id, target_user_id, report_id, note, created_at
+FROM moderation_actions WHERE moderator_id IS NOT NULL;
+
+DROP TABLE moderation_actions;
+ALTER TABLE moderation_actions_old RENAME TO moderation_actions;
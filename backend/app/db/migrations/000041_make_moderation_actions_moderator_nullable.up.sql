@@ -0,0 +1,22 @@
+-- Audit entries outlive the staff accounts that made them: when a former moderator's account is
+-- deleted their entries are kept with moderator_id set to NULL.
+-- SQLite cannot drop a NOT NULL constraint, so moderation_actions is rebuilt.
+
+CREATE TABLE moderation_actions_new (
+    id TEXT PRIMARY KEY,              -- UUID for the audit entry
+    moderator_id TEXT,                -- Moderator who took the action, NULL once their account is deleted
+    action TEXT NOT NULL,             -- e.g. hide_content, unhide_content, suspend_user, dismiss_report
+    content_type TEXT,                -- Type of the affected content, if any
+    content_id TEXT,                  -- ID of the affected content, if any
+    target_user_id TEXT,              -- User affected by the action
+    report_id TEXT,                   -- Report that led to the action, if any
+    note TEXT,                        -- Moderator's note
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (moderator_id) REFERENCES users(id)
+);
+
+INSERT INTO moderation_actions_new SELECT id, moderator_id, action, content_type, content_id, target_user_id, report_id, note, created_at
+FROM moderation_actions;
+
+DROP TABLE moderation_actions;
+ALTER TABLE moderation_actions_new RENAME TO moderation_actions;
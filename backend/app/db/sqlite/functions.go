@@ -0,0 +1,29 @@
+package sqlite
+
+import (
+	"database/sql/driver"
+	"strings"
+
+	sqlitedriver "modernc.org/sqlite"
+)
+
+// FoldCase lower-cases text with Unicode case folding. Muted keywords are stored folded and matched
+// against content folded the same way through the fold_case() SQL function, because SQLite's own
+// lower() only folds ASCII letters.
+func FoldCase(s string) string {
+	return strings.ToLower(s)
+}
+
+func init() {
+	sqlitedriver.MustRegisterDeterministicScalarFunction("fold_case", 1,
+		func(ctx *sqlitedriver.FunctionContext, args []driver.Value) (driver.Value, error) {
+			switch value := args[0].(type) {
+			case string:
+				return FoldCase(value), nil
+			case []byte:
+				return FoldCase(string(value)), nil
+			default:
+				return value, nil
+			}
+		})
+}
@@ -28,7 +28,7 @@ func CreateGroupEventHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		// Get user ID from session
-		userID, err := sessions.GetUserIDFromSession(r)
+		userID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
@@ -100,7 +100,7 @@ func CreateGroupEventHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		// Retrieve the current user's ID from the session.
-		userID, err := sessions.GetUserIDFromSession(r)
+		userID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
@@ -167,7 +167,7 @@ func RSVPGroupEventHandler(db *sql.DB) http.HandlerFunc {
 					return
 			}
 
-			userID, err := sessions.GetUserIDFromSession(r)
+			userID, err := sessions.UserIDFromContext(r.Context())
 			if err != nil {
 					http.Error(w, "Unauthorized", http.StatusUnauthorized)
 					return
@@ -250,7 +250,7 @@ func RemoveRSVPHandler(db *sql.DB) http.HandlerFunc {
 					return
 			}
 
-			userID, err := sessions.GetUserIDFromSession(r)
+			userID, err := sessions.UserIDFromContext(r.Context())
 			if err != nil {
 					http.Error(w, "Unauthorized", http.StatusUnauthorized)
 					return
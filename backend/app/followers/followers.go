@@ -3,11 +3,15 @@ package followers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"social-network/app/blocks"
 	"social-network/app/notifications"
 	"social-network/app/sessions"
+	"strconv"
+	"strings"
 
 	"github.com/google/uuid"
 )
@@ -23,7 +27,7 @@ func FollowHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		// The logged-in user ID from session
-		userID, err := sessions.GetUserIDFromSession(r)
+		userID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
 			return
@@ -56,6 +60,18 @@ func FollowHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		// Blocked users cannot follow each other
+		blocked, err := blocks.IsBlocked(db, userID, request.FollowedID)
+		if err != nil {
+			log.Printf("Error checking block status: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if blocked {
+			http.Error(w, "You cannot follow this user", http.StatusForbidden)
+			return
+		}
+
 		// Check if follow relationship already exists
 		var existingStatus string
 		err = db.QueryRow(`
@@ -166,7 +182,7 @@ func UnfollowHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		// The logged-in user ID from session
-		userID, err := sessions.GetUserIDFromSession(r)
+		userID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
 			return
@@ -216,69 +232,80 @@ func UnfollowHandler(db *sql.DB) http.HandlerFunc {
 	}
 }
 
-// GetFollowersHandler fetches the followers (with details) for the logged-in user
-func GetFollowersHandler(db *sql.DB) http.HandlerFunc {
+// CancelFollowRequestHandler lets the logged-in user withdraw a pending follow request they sent
+func CancelFollowRequestHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
+		if r.Method != http.MethodDelete {
 			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
 			return
 		}
 
-		// Get the logged-in user ID from the session
-		userID, err := sessions.GetUserIDFromSession(r)
+		// The logged-in user (the one who sent the request)
+		userID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
 			return
 		}
 
-		// Join followers with users table to get follower details
-		rows, err := db.Query(`
-			SELECT users.id, users.nickname, users.avatar 
-			FROM followers 
-			JOIN users ON followers.follower_id = users.id 
-			WHERE followers.followed_id = ? AND followers.status = 'accepted'
-		`, userID)
+		var request struct {
+			FollowedID string `json:"followed_id"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if request.FollowedID == "" {
+			http.Error(w, "Missing followed_id", http.StatusBadRequest)
+			return
+		}
+
+		tx, err := db.Begin()
 		if err != nil {
-			http.Error(w, "Failed to fetch followers", http.StatusInternalServerError)
+			http.Error(w, "Failed to cancel follow request", http.StatusInternalServerError)
 			return
 		}
-		defer rows.Close()
+		defer tx.Rollback()
 
-		var followers []struct {
-			ID       string `json:"id"`
-			Nickname string `json:"nickname"`
-			Avatar   string `json:"avatar"`
+		result, err := tx.Exec(`DELETE FROM followers WHERE follower_id = ? AND followed_id = ? AND status = 'pending'`,
+			userID, request.FollowedID)
+		if err != nil {
+			http.Error(w, "Failed to cancel follow request", http.StatusInternalServerError)
+			return
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			http.Error(w, "No pending follow request found", http.StatusNotFound)
+			return
 		}
 
-		for rows.Next() {
-			var follower struct {
-				ID       string `json:"id"`
-				Nickname string `json:"nickname"`
-				Avatar   string `json:"avatar"`
-			}
-			if err := rows.Scan(&follower.ID, &follower.Nickname, &follower.Avatar); err != nil {
-				http.Error(w, "Failed to parse followers", http.StatusInternalServerError)
-				return
-			}
-			followers = append(followers, follower)
+		// Remove the follow_request notification the other user received
+		_, err = tx.Exec("DELETE FROM notifications WHERE user_id = ? AND related_user_id = ? AND type = 'follow_request'", request.FollowedID, userID)
+		if err != nil {
+			http.Error(w, "Failed to delete follow request notification", http.StatusInternalServerError)
+			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(followers)
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to cancel follow request", http.StatusInternalServerError)
+			return
+		}
+
+		w.Write([]byte("Follow request cancelled"))
 	}
 }
 
-// HandleFollowRequest allows the logged-in user (private profile owner)
-// to accept or decline follow requests.
-func HandleFollowRequest(db *sql.DB) http.HandlerFunc {
+// RemoveFollowerHandler lets the logged-in user remove someone who follows them. The removed user is
+// not notified.
+func RemoveFollowerHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPut {
+		if r.Method != http.MethodDelete {
 			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
 			return
 		}
 
-		// The logged-in user (the one receiving the follow request)
-		userID, err := sessions.GetUserIDFromSession(r)
+		// The logged-in user (the one being followed)
+		userID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
 			return
@@ -286,7 +313,6 @@ func HandleFollowRequest(db *sql.DB) http.HandlerFunc {
 
 		var request struct {
 			FollowerID string `json:"follower_id"`
-			Action     string `json:"action"` // "accept" or "decline"
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
@@ -294,65 +320,220 @@ func HandleFollowRequest(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		if request.Action != "accept" && request.Action != "decline" {
-			http.Error(w, "Invalid action, must be 'accept' or 'decline'", http.StatusBadRequest)
+		if request.FollowerID == "" {
+			http.Error(w, "Missing follower_id", http.StatusBadRequest)
 			return
 		}
 
-		var action string
-		if request.Action == "accept" {
-			action = "accepted"
-		} else {
-			action = "declined"
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Failed to remove follower", http.StatusInternalServerError)
+			return
 		}
+		defer tx.Rollback()
 
-		// Update the follow request status
-		result, err := db.Exec(`UPDATE followers SET status = ? WHERE follower_id = ? AND followed_id = ? AND status = 'pending'`,
-			action, request.FollowerID, userID)
+		result, err := tx.Exec(`DELETE FROM followers WHERE follower_id = ? AND followed_id = ? AND status = 'accepted'`,
+			request.FollowerID, userID)
 		if err != nil {
-			http.Error(w, "Failed to update follow request", http.StatusInternalServerError)
+			http.Error(w, "Failed to remove follower", http.StatusInternalServerError)
+			return
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			http.Error(w, "This user is not following you", http.StatusNotFound)
 			return
 		}
 
-		rowsAffected, err := result.RowsAffected()
+		// Clear any follow_request notification still left over from this follower
+		_, err = tx.Exec("DELETE FROM notifications WHERE user_id = ? AND related_user_id = ? AND type = 'follow_request'", userID, request.FollowerID)
 		if err != nil {
-			http.Error(w, "Failed to determine affected rows", http.StatusInternalServerError)
+			http.Error(w, "Failed to delete follow request notification", http.StatusInternalServerError)
 			return
 		}
-		if rowsAffected == 0 {
-			http.Error(w, "No pending follow request found", http.StatusNotFound)
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to remove follower", http.StatusInternalServerError)
+			return
+		}
+
+		w.Write([]byte("Follower removed successfully"))
+	}
+}
+
+// FollowUser is an entry in a follower or following list
+type FollowUser struct {
+	ID       string `json:"id"`
+	Nickname string `json:"nickname"`
+	Avatar   string `json:"avatar"`
+}
+
+// GetFollowersHandler fetches a page of accepted followers of user_id (the logged-in user by default),
+// optionally filtered by nickname with query
+func GetFollowersHandler(db *sql.DB) http.HandlerFunc {
+	return listFollowsHandler(db, "followers", "follower_id", "followed_id")
+}
+
+// GetFollowingHandler fetches a page of the users user_id (the logged-in user by default) follows,
+// optionally filtered by nickname with query
+func GetFollowingHandler(db *sql.DB) http.HandlerFunc {
+	return listFollowsHandler(db, "following", "followed_id", "follower_id")
+}
+
+// listFollowsHandler serves one side of the follow graph: it lists users in listColumn whose
+// accepted follow edge has the target user in ownerColumn. Lists of a private account are only
+// shown to the owner and their accepted followers.
+func listFollowsHandler(db *sql.DB, key, listColumn, ownerColumn string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
 			return
 		}
 
-		// Remove the original follow_request notification
-		_, err = db.Exec("DELETE FROM notifications WHERE user_id = ? AND related_user_id = ? AND type = 'follow_request'", userID, request.FollowerID)
+		// Get the logged-in user ID from the session
+		userID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
-			http.Error(w, "Failed to delete follow request notification", http.StatusInternalServerError)
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
 			return
 		}
 
-		// Fetch the nickname of the logged-in user (the one accepting/declining)
-		var userNickname string
-		err = db.QueryRow(`SELECT nickname FROM users WHERE id = ?`, userID).Scan(&userNickname)
+		query := r.URL.Query()
+		targetID := query.Get("user_id")
+		if targetID == "" {
+			targetID = userID
+		}
+
+		if targetID != userID {
+			var private, blockedByTarget, isFollower bool
+			err = db.QueryRow(`
+				SELECT COALESCE(private, 0),
+				       EXISTS(SELECT 1 FROM blocks WHERE blocker_id = users.id AND blocked_id = ?2),
+				       EXISTS(SELECT 1 FROM followers WHERE follower_id = ?2 AND followed_id = users.id AND status = 'accepted')
+				FROM users WHERE id = ?1`, targetID, userID).Scan(&private, &blockedByTarget, &isFollower)
+			if errors.Is(err, sql.ErrNoRows) || blockedByTarget {
+				http.Error(w, "User not found", http.StatusNotFound)
+				return
+			} else if err != nil {
+				http.Error(w, "Failed to fetch user", http.StatusInternalServerError)
+				return
+			}
+			if private && !isFollower {
+				http.Error(w, "Forbidden: This profile is private", http.StatusForbidden)
+				return
+			}
+		}
+
+		limit, err := strconv.Atoi(query.Get("limit"))
+		if err != nil || limit <= 0 || limit > 100 {
+			limit = 20
+		}
+		page, err := strconv.Atoi(query.Get("page"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+		search := strings.TrimSpace(query.Get("query"))
+
+		users, total, err := listFollows(db, userID, targetID, listColumn, ownerColumn, search, page, limit)
 		if err != nil {
-			log.Printf("Error fetching user nickname: %v", err)
-			http.Error(w, "Error fetching user nickname", http.StatusInternalServerError)
+			log.Printf("Error fetching %s: %v", key, err)
+			http.Error(w, "Failed to fetch "+key, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			key:       users,
+			"total":   total,
+			"page":    page,
+			"limit":   limit,
+			"user_id": targetID,
+		})
+	}
+}
+
+// FollowersPage returns a page of the user's own accepted followers, newest first, with their total
+func FollowersPage(db *sql.DB, userID string, page, limit int) ([]FollowUser, int, error) {
+	return listFollows(db, userID, userID, "follower_id", "followed_id", "", page, limit)
+}
+
+// listFollows returns a page of the users in listColumn whose accepted follow edge has targetID in
+// ownerColumn, filtered by nickname with search, and how many there are in total. Users blocked
+// either way by the viewer are left out of the page and the total.
+func listFollows(db *sql.DB, viewerID, targetID, listColumn, ownerColumn, search string, page, limit int) ([]FollowUser, int, error) {
+	filter := `
+		FROM followers f
+		JOIN users u ON u.id = f.` + listColumn + `
+		WHERE f.` + ownerColumn + ` = ?1 AND f.status = 'accepted'
+		  AND (?2 = '' OR u.nickname LIKE '%' || ?2 || '%')
+		  AND NOT EXISTS (
+			SELECT 1 FROM blocks
+			WHERE (blocker_id = u.id AND blocked_id = ?3)
+			   OR (blocker_id = ?3 AND blocked_id = u.id)
+		  )`
+
+	var total int
+	if err := db.QueryRow(`SELECT COUNT(*) `+filter, targetID, search, viewerID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query(`
+		SELECT u.id, COALESCE(u.nickname, ''), COALESCE(u.avatar, '') `+filter+`
+		ORDER BY f.created_at DESC
+		LIMIT ?4 OFFSET ?5`, targetID, search, viewerID, limit, (page-1)*limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []FollowUser{}
+	for rows.Next() {
+		var user FollowUser
+		if err := rows.Scan(&user.ID, &user.Nickname, &user.Avatar); err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+	return users, total, rows.Err()
+}
+
+// HandleFollowRequest allows the logged-in user (private profile owner)
+// to accept or decline follow requests.
+func HandleFollowRequest(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// The logged-in user (the one receiving the follow request)
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var request struct {
+			FollowerID string `json:"follower_id"`
+			Action     string `json:"action"` // "accept" or "decline"
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if request.Action != "accept" && request.Action != "decline" {
+			http.Error(w, "Invalid action, must be 'accept' or 'decline'", http.StatusBadRequest)
 			return
 		}
 
-		// Send a follow_response notification to the requester
-		err = notifications.CreateNotification(
-			db,
-			request.FollowerID, // The user who made the follow request
-			"follow_response",  // Notification type for the follow response
-			fmt.Sprintf("%s has %s your follow request.", userNickname, request.Action),
-			"",    // postID
-			userID, // relatedUserID: the responder
-			"",    // groupID
-			"",
-		)
+		answered, err := RespondToFollowRequests(db, userID, []string{request.FollowerID}, request.Action == "accept")
 		if err != nil {
-			log.Println("Failed to create follow response notification:", err)
+			log.Printf("Error answering follow request: %v", err)
+			http.Error(w, "Failed to update follow request", http.StatusInternalServerError)
+			return
+		}
+		if len(answered) == 0 {
+			http.Error(w, "No pending follow request found", http.StatusNotFound)
+			return
 		}
 
 		w.WriteHeader(http.StatusOK)
@@ -369,7 +550,7 @@ func GetFollowRequestsHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		// Get the logged-in user ID from the session
-		userID, err := sessions.GetUserIDFromSession(r)
+		userID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
 			return
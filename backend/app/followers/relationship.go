@@ -0,0 +1,162 @@
+package followers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"social-network/app/sessions"
+	"strconv"
+)
+
+// Relationship summarises how the viewer and another user are connected
+type Relationship struct {
+	IsSelf               bool `json:"is_self"`
+	Following            bool `json:"following"`
+	FollowedBy           bool `json:"followed_by"`
+	RequestSent          bool `json:"request_sent"`
+	RequestReceived      bool `json:"request_received"`
+	Mutual               bool `json:"mutual"`
+	MutualFollowersCount int  `json:"mutual_followers_count"`
+}
+
+// MutualFollower is someone the viewer follows who also follows the target
+type MutualFollower struct {
+	ID       string `json:"id"`
+	Nickname string `json:"nickname"`
+	Avatar   string `json:"avatar"`
+}
+
+// relationshipQuery reads every follow edge between the viewer (?1) and the target (?2) in one go.
+// Mutual followers are accepted followers of the target that the viewer follows too, leaving out
+// anyone blocked either way by the viewer.
+const relationshipQuery = `
+	SELECT
+		EXISTS(SELECT 1 FROM followers WHERE follower_id = ?1 AND followed_id = ?2 AND status = 'accepted'),
+		EXISTS(SELECT 1 FROM followers WHERE follower_id = ?2 AND followed_id = ?1 AND status = 'accepted'),
+		EXISTS(SELECT 1 FROM followers WHERE follower_id = ?1 AND followed_id = ?2 AND status = 'pending'),
+		EXISTS(SELECT 1 FROM followers WHERE follower_id = ?2 AND followed_id = ?1 AND status = 'pending'),
+		(SELECT COUNT(*) FROM followers f` + mutualFollowersJoin + `)
+`
+
+// mutualFollowersJoin is shared by the count above and the paginated list below
+const mutualFollowersJoin = `
+		WHERE f.followed_id = ?2 AND f.status = 'accepted' AND f.follower_id != ?1
+		  AND f.follower_id IN (SELECT followed_id FROM followers WHERE follower_id = ?1 AND status = 'accepted')
+		  AND NOT EXISTS (
+			SELECT 1 FROM blocks
+			WHERE (blocker_id = f.follower_id AND blocked_id = ?1)
+			   OR (blocker_id = ?1 AND blocked_id = f.follower_id)
+		  )`
+
+// GetRelationship returns the relationship between the viewer and the target user
+func GetRelationship(db *sql.DB, viewerID, targetID string) (Relationship, error) {
+	if viewerID == targetID {
+		return Relationship{IsSelf: true}, nil
+	}
+
+	var rel Relationship
+	err := db.QueryRow(relationshipQuery, viewerID, targetID).Scan(
+		&rel.Following, &rel.FollowedBy, &rel.RequestSent, &rel.RequestReceived, &rel.MutualFollowersCount)
+	if err != nil {
+		return Relationship{}, err
+	}
+	rel.Mutual = rel.Following && rel.FollowedBy
+	return rel, nil
+}
+
+// GetMutualFollowers returns a page of the users the viewer follows who also follow the target
+func GetMutualFollowers(db *sql.DB, viewerID, targetID string, limit, offset int) ([]MutualFollower, error) {
+	rows, err := db.Query(`
+		SELECT u.id, COALESCE(u.nickname, ''), COALESCE(u.avatar, '')
+		FROM followers f
+		JOIN users u ON u.id = f.follower_id`+mutualFollowersJoin+`
+		ORDER BY u.nickname
+		LIMIT ?3 OFFSET ?4`, viewerID, targetID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mutuals := []MutualFollower{}
+	for rows.Next() {
+		var m MutualFollower
+		if err := rows.Scan(&m.ID, &m.Nickname, &m.Avatar); err != nil {
+			return nil, err
+		}
+		mutuals = append(mutuals, m)
+	}
+	return mutuals, rows.Err()
+}
+
+// GetRelationshipHandler returns the logged-in user's relationship with user_id together with a
+// page of their mutual followers
+func GetRelationshipHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		targetID := r.URL.Query().Get("user_id")
+		if targetID == "" {
+			http.Error(w, "Missing user_id", http.StatusBadRequest)
+			return
+		}
+
+		// Users who blocked the viewer are hidden the same way their profile is
+		var exists bool
+		err = db.QueryRow(`
+			SELECT EXISTS(SELECT 1 FROM users WHERE id = ?1)
+			   AND NOT EXISTS(SELECT 1 FROM blocks WHERE blocker_id = ?1 AND blocked_id = ?2)`,
+			targetID, userID).Scan(&exists)
+		if err != nil {
+			http.Error(w, "Failed to fetch user", http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil || limit <= 0 || limit > 50 {
+			limit = 20
+		}
+		page, err := strconv.Atoi(r.URL.Query().Get("page"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+
+		rel, err := GetRelationship(db, userID, targetID)
+		if err != nil {
+			log.Printf("Error fetching relationship: %v", err)
+			http.Error(w, "Failed to fetch relationship", http.StatusInternalServerError)
+			return
+		}
+		mutuals := []MutualFollower{}
+		if !rel.IsSelf {
+			mutuals, err = GetMutualFollowers(db, userID, targetID, limit, (page-1)*limit)
+			if err != nil {
+				log.Printf("Error fetching mutual followers: %v", err)
+				http.Error(w, "Failed to fetch mutual followers", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"user_id":          targetID,
+			"relationship":     rel,
+			"mutual_followers": mutuals,
+			"page":             page,
+			"limit":            limit,
+		})
+	}
+}
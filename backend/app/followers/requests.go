@@ -0,0 +1,156 @@
+package followers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"social-network/app/notifications"
+	"social-network/app/sessions"
+	"strings"
+)
+
+// RespondToFollowRequests accepts or declines pending follow requests sent to userID, either from
+// the given followerIDs or, when followerIDs is nil, all of them. The matching follow_request
+// notifications are removed and every requester gets a follow_response notification. It returns
+// the IDs of the requesters whose request was answered.
+func RespondToFollowRequests(db *sql.DB, userID string, followerIDs []string, accept bool) ([]string, error) {
+	status := "declined"
+	if accept {
+		status = "accepted"
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT follower_id FROM followers WHERE followed_id = ? AND status = 'pending'`
+	args := []interface{}{userID}
+	if followerIDs != nil {
+		if len(followerIDs) == 0 {
+			return []string{}, nil
+		}
+		query += ` AND follower_id IN (?` + strings.Repeat(", ?", len(followerIDs)-1) + `)`
+		for _, id := range followerIDs {
+			args = append(args, id)
+		}
+	}
+
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	answered := []string{}
+	for rows.Next() {
+		var followerID string
+		if err := rows.Scan(&followerID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		answered = append(answered, followerID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, followerID := range answered {
+		if _, err := tx.Exec(`UPDATE followers SET status = ? WHERE follower_id = ? AND followed_id = ? AND status = 'pending'`,
+			status, followerID, userID); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(`DELETE FROM notifications WHERE user_id = ? AND related_user_id = ? AND type = 'follow_request'`,
+			userID, followerID); err != nil {
+			return nil, err
+		}
+	}
+
+	var nickname string
+	if err := tx.QueryRow(`SELECT nickname FROM users WHERE id = ?`, userID).Scan(&nickname); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	for _, followerID := range answered {
+		err := notifications.CreateNotification(
+			db,
+			followerID,        // The user who made the follow request
+			"follow_response", // Notification type for the follow response
+			fmt.Sprintf("%s has %s your follow request.", nickname, status),
+			"",     // postID
+			userID, // relatedUserID: the responder
+			"",     // groupID
+			"",
+		)
+		if err != nil {
+			log.Println("Failed to create follow response notification:", err)
+		}
+	}
+	return answered, nil
+}
+
+// BulkFollowRequestsHandler accepts or declines several pending follow requests at once. Either
+// follower_ids lists the requesters or all is set to answer every pending request.
+func BulkFollowRequestsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// The logged-in user (the one receiving the follow requests)
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var request struct {
+			FollowerIDs []string `json:"follower_ids"`
+			All         bool     `json:"all"`
+			Action      string   `json:"action"` // "accept" or "decline"
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if request.Action != "accept" && request.Action != "decline" {
+			http.Error(w, "Invalid action, must be 'accept' or 'decline'", http.StatusBadRequest)
+			return
+		}
+
+		var followerIDs []string
+		if !request.All {
+			if len(request.FollowerIDs) == 0 {
+				http.Error(w, "Missing follower_ids", http.StatusBadRequest)
+				return
+			}
+			if len(request.FollowerIDs) > 100 {
+				http.Error(w, "Too many follower_ids, at most 100 per request", http.StatusBadRequest)
+				return
+			}
+			followerIDs = request.FollowerIDs
+		}
+
+		answered, err := RespondToFollowRequests(db, userID, followerIDs, request.Action == "accept")
+		if err != nil {
+			log.Printf("Error answering follow requests: %v", err)
+			http.Error(w, "Failed to update follow requests", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"action":       request.Action,
+			"follower_ids": answered,
+			"count":        len(answered),
+		})
+	}
+}
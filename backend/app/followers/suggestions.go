@@ -0,0 +1,171 @@
+package followers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"social-network/app/sessions"
+	"strconv"
+	"strings"
+)
+
+// Weights of each signal in a suggestion's score. Following the same people says more than
+// sharing a group, which says more than going to the same event.
+const (
+	mutualFollowWeight = 3
+	sharedGroupWeight  = 2
+	sharedEventWeight  = 1
+)
+
+// Suggestion is a user the viewer may know, with the signals that led to it
+type Suggestion struct {
+	ID            string   `json:"id"`
+	Nickname      string   `json:"nickname"`
+	Avatar        string   `json:"avatar"`
+	Private       bool     `json:"private"`
+	MutualFollows int      `json:"mutual_follows"`
+	SharedGroups  int      `json:"shared_groups"`
+	SharedEvents  int      `json:"shared_events"`
+	Score         int      `json:"score"`
+	Reasons       []string `json:"reasons"`
+	Explanation   string   `json:"explanation"`
+}
+
+// suggestionsQuery ranks candidates for the viewer (?1). Every signal is built from data the viewer
+// can already see: follow edges of people the viewer follows, members of groups the viewer belongs
+// to and attendees of events the viewer is going to. Nothing about a private candidate's own
+// followers or followings is used.
+const suggestionsQuery = `
+	WITH signals AS (
+		SELECT f.followed_id AS candidate_id, COUNT(*) AS mutual_follows, 0 AS shared_groups, 0 AS shared_events
+		FROM followers f
+		WHERE f.status = 'accepted'
+		  AND f.follower_id IN (SELECT followed_id FROM followers WHERE follower_id = ?1 AND status = 'accepted')
+		GROUP BY f.followed_id
+
+		UNION ALL
+		SELECT gm.user_id, 0, COUNT(DISTINCT gm.group_id), 0
+		FROM group_membership gm
+		WHERE gm.status = 'member'
+		  AND gm.group_id IN (SELECT group_id FROM group_membership WHERE user_id = ?1 AND status = 'member')
+		GROUP BY gm.user_id
+
+		UNION ALL
+		SELECT r.user_id, 0, 0, COUNT(DISTINCT r.event_id)
+		FROM event_rsvp r
+		WHERE r.status = 'going'
+		  AND r.event_id IN (SELECT event_id FROM event_rsvp WHERE user_id = ?1 AND status = 'going')
+		GROUP BY r.user_id
+	),
+	scored AS (
+		SELECT candidate_id,
+		       SUM(mutual_follows) AS mutual_follows,
+		       SUM(shared_groups) AS shared_groups,
+		       SUM(shared_events) AS shared_events
+		FROM signals
+		GROUP BY candidate_id
+	)
+	SELECT u.id, COALESCE(u.nickname, ''), COALESCE(u.avatar, ''), COALESCE(u.private, 0),
+	       s.mutual_follows, s.shared_groups, s.shared_events,
+	       s.mutual_follows * ?2 + s.shared_groups * ?3 + s.shared_events * ?4 AS score
+	FROM scored s
+	JOIN users u ON u.id = s.candidate_id
+	WHERE u.id != ?1
+	  AND COALESCE(u.suspended, 0) = 0
+	  AND NOT EXISTS (
+		SELECT 1 FROM followers
+		WHERE follower_id = ?1 AND followed_id = u.id AND status IN ('accepted', 'pending')
+	  )
+	  AND NOT EXISTS (
+		SELECT 1 FROM blocks
+		WHERE (blocker_id = u.id AND blocked_id = ?1)
+		   OR (blocker_id = ?1 AND blocked_id = u.id)
+	  )
+	  AND NOT EXISTS (SELECT 1 FROM muted_users WHERE user_id = ?1 AND muted_user_id = u.id)
+	ORDER BY score DESC, s.mutual_follows DESC, u.nickname
+	LIMIT ?5 OFFSET ?6
+`
+
+// plural formats a count with a singular or plural noun, e.g. "1 shared group" or "3 shared groups"
+func plural(n int, singular, pluralForm string) string {
+	if n == 1 {
+		return "1 " + singular
+	}
+	return strconv.Itoa(n) + " " + pluralForm
+}
+
+// explain turns a suggestion's signals into human-readable reasons, strongest first
+func (s *Suggestion) explain() {
+	s.Reasons = []string{}
+	if s.MutualFollows > 0 {
+		s.Reasons = append(s.Reasons, plural(s.MutualFollows, "mutual follower", "mutual followers"))
+	}
+	if s.SharedGroups > 0 {
+		s.Reasons = append(s.Reasons, plural(s.SharedGroups, "shared group", "shared groups"))
+	}
+	if s.SharedEvents > 0 {
+		s.Reasons = append(s.Reasons, plural(s.SharedEvents, "shared event", "shared events"))
+	}
+	s.Explanation = strings.Join(s.Reasons, ", ")
+}
+
+// GetSuggestions returns a page of ranked follow suggestions for the user
+func GetSuggestions(db *sql.DB, userID string, limit, offset int) ([]Suggestion, error) {
+	rows, err := db.Query(suggestionsQuery, userID, mutualFollowWeight, sharedGroupWeight, sharedEventWeight, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []Suggestion{}
+	for rows.Next() {
+		var s Suggestion
+		if err := rows.Scan(&s.ID, &s.Nickname, &s.Avatar, &s.Private,
+			&s.MutualFollows, &s.SharedGroups, &s.SharedEvents, &s.Score); err != nil {
+			return nil, err
+		}
+		s.explain()
+		suggestions = append(suggestions, s)
+	}
+	return suggestions, rows.Err()
+}
+
+// GetSuggestionsHandler returns "people you may know" for the logged-in user, paginated with page and limit
+func GetSuggestionsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil || limit <= 0 || limit > 50 {
+			limit = 10
+		}
+		page, err := strconv.Atoi(r.URL.Query().Get("page"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+
+		suggestions, err := GetSuggestions(db, userID, limit, (page-1)*limit)
+		if err != nil {
+			log.Printf("Error fetching suggestions: %v", err)
+			http.Error(w, "Failed to fetch suggestions", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"suggestions": suggestions,
+			"page":        page,
+			"limit":       limit,
+		})
+	}
+}
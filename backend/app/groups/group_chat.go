@@ -7,6 +7,8 @@ import (
 	"net/http"
 	"sync"
 
+	"social-network/app/mentions"
+	"social-network/app/ratelimit"
 	"social-network/app/sessions"
 
 	"github.com/google/uuid"
@@ -24,6 +26,9 @@ type Client struct {
 var clients = make(map[*websocket.Conn]Client)
 var clientsMutex = sync.Mutex{}
 
+// messageLimiter caps how many group chat messages a user can send per second across all groups
+var messageLimiter = ratelimit.NewLimiter(5, 10)
+
 // Upgrader upgrades HTTP connections to WebSocket connections.
 var upgrader = websocket.Upgrader{
 	// Allow connections from any origin (adjust this in production)
@@ -37,30 +42,23 @@ type ChatMessage struct {
 	Message  string `json:"message"`
 	Nickname string `json:"nickname"`  // Sender's nickname.
 	Avatar   string `json:"avatar"`    // Sender's avatar.
+	Entities []mentions.Entity `json:"entities,omitempty"` // Mentions in the message.
 }
 
-// GroupChatHandler upgrades the connection and processes messages.
+// GroupChatHandler checks the user is a group member, upgrades the connection and processes messages.
 func GroupChatHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Upgrade the HTTP connection to a WebSocket.
-		conn, err := upgrader.Upgrade(w, r, nil)
-		if err != nil {
-			log.Println("WebSocket upgrade error:", err)
-			return
-		}
-		defer conn.Close()
-
-		// Authenticate the user.
-		userID, err := sessions.GetUserIDFromSession(r)
+		// Authenticate the user and check membership before upgrading, so failures are plain HTTP errors.
+		userID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
-			conn.WriteMessage(websocket.TextMessage, []byte("Unauthorized"))
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
 		// Retrieve the group ID from query parameters.
 		groupID := r.URL.Query().Get("group_id")
 		if groupID == "" {
-			conn.WriteMessage(websocket.TextMessage, []byte("Missing group_id"))
+			http.Error(w, "Missing group_id", http.StatusBadRequest)
 			return
 		}
 
@@ -68,9 +66,17 @@ func GroupChatHandler(db *sql.DB) http.HandlerFunc {
 		var isMember bool
 		err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM group_membership WHERE group_id = ? AND user_id = ?)", groupID, userID).Scan(&isMember)
 		if err != nil || !isMember {
-			conn.WriteMessage(websocket.TextMessage, []byte("Not a member of this group"))
+			http.Error(w, "Not a member of this group", http.StatusForbidden)
+			return
+		}
+
+		// Upgrade the HTTP connection to a WebSocket.
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Println("WebSocket upgrade error:", err)
 			return
 		}
+		defer conn.Close()
 
 		// Add the connection to our clients map.
 		clientsMutex.Lock()
@@ -95,6 +101,14 @@ func GroupChatHandler(db *sql.DB) http.HandlerFunc {
 				continue
 			}
 
+			// Throttle senders that flood the group.
+			if ok, _ := messageLimiter.Allow(userID); !ok {
+				errorMsg := map[string]string{"error": "You are sending messages too fast."}
+				errorBytes, _ := json.Marshal(errorMsg)
+				conn.WriteMessage(websocket.TextMessage, errorBytes)
+				continue
+			}
+
 			// Override the fields to ensure data integrity.
 			msg.SenderID = userID
 			msg.GroupID = groupID
@@ -124,6 +138,12 @@ func GroupChatHandler(db *sql.DB) http.HandlerFunc {
 				continue
 			}
 
+			// Link and notify the members mentioned in the message.
+			msg.Entities, err = mentions.Process(db, mentions.Content{Type: "group_chat_message", ID: messageID, AuthorID: userID, GroupID: groupID}, msg.Message)
+			if err != nil {
+				log.Println("Failed to process mentions:", err)
+			}
+
 			// Marshal the message (now including Nickname and Avatar) for broadcasting.
 			broadcastMessage, err := json.Marshal(msg)
 			if err != nil {
@@ -164,10 +184,10 @@ func GetGroupChatMessagesHandler(db *sql.DB) http.HandlerFunc {
 
 		// Query past messages by joining with the users table.
 		rows, err := db.Query(`
-			SELECT m.sender_id, m.message, m.created_at, u.nickname, u.avatar
+			SELECT m.id, m.sender_id, m.message, m.created_at, u.nickname, u.avatar
 			FROM group_chat_messages m
 			JOIN users u ON m.sender_id = u.id
-			WHERE m.group_id = ?
+			WHERE m.group_id = ? AND m.hidden = 0
 			ORDER BY m.created_at ASC
 		`, groupID)
 		if err != nil {
@@ -177,22 +197,38 @@ func GetGroupChatMessagesHandler(db *sql.DB) http.HandlerFunc {
 		defer rows.Close()
 
 		type MessageResponse struct {
+			ID        string `json:"id"`
 			SenderID  string `json:"sender_id"`
 			Message   string `json:"message"`
 			CreatedAt string `json:"created_at"`
 			Nickname  string `json:"nickname"`
 			Avatar    string `json:"avatar"`
+			Entities  []mentions.Entity `json:"entities,omitempty"`
 		}
 		var messages []MessageResponse
 		for rows.Next() {
 			var msg MessageResponse
-			if err := rows.Scan(&msg.SenderID, &msg.Message, &msg.CreatedAt, &msg.Nickname, &msg.Avatar); err != nil {
+			if err := rows.Scan(&msg.ID, &msg.SenderID, &msg.Message, &msg.CreatedAt, &msg.Nickname, &msg.Avatar); err != nil {
 				http.Error(w, "Error processing messages", http.StatusInternalServerError)
 				return
 			}
 			messages = append(messages, msg)
 		}
 
+		// Attach the mentions of each message.
+		ids := make([]string, len(messages))
+		for i, msg := range messages {
+			ids[i] = msg.ID
+		}
+		found, err := mentions.Load(db, "group_chat_message", ids)
+		if err != nil {
+			http.Error(w, "Failed to fetch mentions", http.StatusInternalServerError)
+			return
+		}
+		for i := range messages {
+			messages[i].Entities = found[messages[i].ID]
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(messages)
 	}
@@ -11,8 +11,12 @@ import (
 	"path/filepath"
 	"strings"
 
+	"social-network/app/followers"
+	"social-network/app/hashtags"
+	"social-network/app/mentions"
 	"social-network/app/notifications"
 	"social-network/app/sessions"
+	"social-network/app/users"
 
 	"github.com/google/uuid"
 )
@@ -34,7 +38,7 @@ func GetAllGroupsHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		// Get logged-in user ID
-		userID, err := sessions.GetUserIDFromSession(r)
+		userID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
@@ -99,7 +103,7 @@ func GetGroupDetailsHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		// Must be logged in
-		userID, err := sessions.GetUserIDFromSession(r)
+		userID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
@@ -216,7 +220,7 @@ func CreateGroupHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		userID, err := sessions.GetUserIDFromSession(r)
+		userID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
@@ -276,7 +280,7 @@ func RequestToJoinHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		userID, err := sessions.GetUserIDFromSession(r)
+		userID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
@@ -344,7 +348,7 @@ func HandleJoinRequestHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		// Get the group creator’s (logged-in user's) ID from the session.
-		creatorID, err := sessions.GetUserIDFromSession(r)
+		creatorID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
@@ -441,7 +445,7 @@ func SendInvitationHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		// Get user ID of the inviter from session.
-		inviterID, err := sessions.GetUserIDFromSession(r)
+		inviterID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
@@ -465,9 +469,8 @@ func SendInvitationHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Look up the user ID corresponding to the given nickname.
-		var inviteeID string
-		err = db.QueryRow(`SELECT id FROM users WHERE nickname = ?`, invite.Nickname).Scan(&inviteeID)
+		// Look up the user ID corresponding to the given nickname, following recently changed ones.
+		inviteeID, _, err := users.ResolveNickname(db, invite.Nickname)
 		if err != nil {
 			log.Printf("Failed to find user by nickname %s: %v", invite.Nickname, err)
 			http.Error(w, "User not found", http.StatusBadRequest)
@@ -544,7 +547,7 @@ func HandleInvitationHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		// Get user ID from session (this is the invitee).
-		userID, err := sessions.GetUserIDFromSession(r)
+		userID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
@@ -635,7 +638,7 @@ func LeaveGroupHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		userID, err := sessions.GetUserIDFromSession(r)
+		userID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
@@ -691,7 +694,7 @@ func GetUserGroupsHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		// Get user ID from session
-		userID, err := sessions.GetUserIDFromSession(r)
+		userID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
@@ -734,7 +737,7 @@ func GetPendingRequestsHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		creatorID, err := sessions.GetUserIDFromSession(r)
+		creatorID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
@@ -777,7 +780,7 @@ func RemoveMemberHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		creatorID, err := sessions.GetUserIDFromSession(r)
+		creatorID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
@@ -833,7 +836,7 @@ func DeleteGroupHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		creatorID, err := sessions.GetUserIDFromSession(r)
+		creatorID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
@@ -862,12 +865,40 @@ func DeleteGroupHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		_, err = db.Exec(`DELETE FROM groups WHERE id = ? AND creator_id = ?`,
+		// Posts, comments and chat messages go with the group; their mentions and hashtags are removed first
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Failed to delete group", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+		_, err = tx.Exec(`
+			DELETE FROM mentions
+			WHERE (content_type = 'group_post' AND content_id IN (SELECT id FROM group_posts WHERE group_id = ?1))
+			   OR (content_type = 'group_post_comment' AND content_id IN
+			       (SELECT id FROM group_post_comments WHERE post_id IN (SELECT id FROM group_posts WHERE group_id = ?1)))
+			   OR (content_type = 'group_chat_message' AND content_id IN (SELECT id FROM group_chat_messages WHERE group_id = ?1))`,
+			request.GroupID)
+		if err != nil {
+			http.Error(w, "Failed to delete group mentions", http.StatusInternalServerError)
+			return
+		}
+		_, err = tx.Exec(`DELETE FROM hashtags WHERE content_type = 'group_post' AND content_id IN (SELECT id FROM group_posts WHERE group_id = ?)`,
+			request.GroupID)
+		if err != nil {
+			http.Error(w, "Failed to delete group hashtags", http.StatusInternalServerError)
+			return
+		}
+		_, err = tx.Exec(`DELETE FROM groups WHERE id = ? AND creator_id = ?`,
 			request.GroupID, creatorID)
 		if err != nil {
 			http.Error(w, "Failed to delete group", http.StatusInternalServerError)
 			return
 		}
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to delete group", http.StatusInternalServerError)
+			return
+		}
 
 		w.Write([]byte("Group deleted successfully"))
 	}
@@ -881,7 +912,7 @@ func GetGroupMembersHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		userID, err := sessions.GetUserIDFromSession(r)
+		userID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
@@ -905,7 +936,7 @@ func GetGroupMembersHandler(db *sql.DB) http.HandlerFunc {
 
 		// Fetch members of the group
 		rows, err := db.Query(`
-					SELECT u.id, u.first_name, u.last_name, u.nickname, u.avatar 
+					SELECT u.id, u.first_name, u.last_name, u.nickname, u.avatar, u.name_visibility, COALESCE(u.private, 0)
 					FROM users u
 					INNER JOIN group_membership gm ON u.id = gm.user_id
 					WHERE gm.group_id = ? AND gm.status = 'member'
@@ -917,19 +948,30 @@ func GetGroupMembersHandler(db *sql.DB) http.HandlerFunc {
 		defer rows.Close()
 
 		// Store members in a slice
-		var members []map[string]string
+		var members []map[string]interface{}
 		for rows.Next() {
-			var userID, firstName, lastName, nickname, avatar string
-			if err := rows.Scan(&userID, &firstName, &lastName, &nickname, &avatar); err != nil {
+			var memberID, firstName, lastName, nickname, avatar, nameVisibility string
+			var private bool
+			if err := rows.Scan(&memberID, &firstName, &lastName, &nickname, &avatar, &nameVisibility, &private); err != nil {
 				http.Error(w, "Failed to parse members data", http.StatusInternalServerError)
 				return
 			}
-			members = append(members, map[string]string{
-				"id":         userID,
-				"first_name": firstName,
-				"last_name":  lastName,
-				"nickname":   nickname,
-				"avatar":     avatar,
+			relationship, err := followers.GetRelationship(db, userID, memberID)
+			if err != nil {
+				http.Error(w, "Failed to fetch relationship", http.StatusInternalServerError)
+				return
+			}
+			// Members only see each other's names when the name is visible to them
+			if !users.CanViewField(users.EffectiveVisibility(nameVisibility, private), relationship) {
+				firstName, lastName = "", ""
+			}
+			members = append(members, map[string]interface{}{
+				"id":           memberID,
+				"first_name":   firstName,
+				"last_name":    lastName,
+				"nickname":     nickname,
+				"avatar":       avatar,
+				"relationship": relationship,
 			})
 		}
 
@@ -946,7 +988,7 @@ func CreateGroupPostHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		userID, err := sessions.GetUserIDFromSession(r)
+		userID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
@@ -1028,12 +1070,27 @@ func CreateGroupPostHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		// Link and notify the members mentioned in the post
+		entities, err := mentions.Process(db, mentions.Content{Type: "group_post", ID: postID, AuthorID: userID, GroupID: groupID}, content)
+		if err != nil {
+			log.Printf("Failed to process mentions for group post %s: %v", postID, err)
+		}
+
+		// Index the hashtags used in the post
+		tags, err := hashtags.Save(db, "group_post", postID, content)
+		if err != nil {
+			log.Printf("Failed to index hashtags for group post %s: %v", postID, err)
+		}
+
 		// Send response
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{
+		json.NewEncoder(w).Encode(map[string]interface{}{
 			"message":   "Group post created successfully",
 			"post_id":   postID,
 			"image_url": imageURL,
+			"content":   content,
+			"entities":  entities,
+			"hashtags":  tags,
 		})
 	}
 }
@@ -1057,7 +1114,7 @@ func DeleteGroupPostHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		// Get user ID from session
-		userID, err := sessions.GetUserIDFromSession(r)
+		userID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
@@ -1087,12 +1144,30 @@ func DeleteGroupPostHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Delete the post
-		_, err = db.Exec(`DELETE FROM group_posts WHERE id = ?`, postID)
+		// Delete the post together with its comments and the mentions and hashtags in them
+		queries := []string{
+			`DELETE FROM mentions WHERE (content_type = 'group_post' AND content_id = ?1)
+			    OR (content_type = 'group_post_comment' AND content_id IN (SELECT id FROM group_post_comments WHERE post_id = ?1))`,
+			`DELETE FROM hashtags WHERE content_type = 'group_post' AND content_id = ?`,
+			`DELETE FROM group_post_comments WHERE post_id = ?`,
+			`DELETE FROM group_posts WHERE id = ?`,
+		}
+		tx, err := db.Begin()
 		if err != nil {
 			http.Error(w, "Failed to delete post", http.StatusInternalServerError)
 			return
 		}
+		defer tx.Rollback()
+		for _, query := range queries {
+			if _, err := tx.Exec(query, postID); err != nil {
+				http.Error(w, "Failed to delete post", http.StatusInternalServerError)
+				return
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to delete post", http.StatusInternalServerError)
+			return
+		}
 
 		w.Write([]byte("Group post deleted successfully"))
 	}
@@ -1108,7 +1183,7 @@ func GetGroupPostsHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		// Retrieve the user ID from the session.
-		userID, err := sessions.GetUserIDFromSession(r)
+		userID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
@@ -1134,6 +1209,9 @@ func GetGroupPostsHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		// Muted accounts and keywords are filtered out unless show_muted=true is passed
+		showMuted := r.URL.Query().Get("show_muted") == "true"
+
 		// Fetch all posts from the group, joining with the users table
 		// to retrieve the creator's nickname and avatar.
 		rows, err := db.Query(`
@@ -1147,9 +1225,15 @@ func GetGroupPostsHandler(db *sql.DB) http.HandlerFunc {
 				u.avatar
 			FROM group_posts gp
 			JOIN users u ON gp.user_id = u.id
-			WHERE gp.group_id = ?
+			WHERE gp.group_id = ? AND gp.hidden = 0
+			AND (? OR (
+				NOT EXISTS(SELECT 1 FROM muted_users WHERE user_id = ? AND muted_user_id = gp.user_id)
+				AND (gp.user_id = ? OR NOT EXISTS(
+					SELECT 1 FROM muted_keywords WHERE user_id = ? AND instr(fold_case(gp.content), keyword) > 0
+				))
+			))
 			ORDER BY gp.created_at DESC
-		`, groupID)
+		`, groupID, showMuted, userID, userID, userID)
 		if err != nil {
 			http.Error(w, "Failed to fetch group posts", http.StatusInternalServerError)
 			return
@@ -1157,14 +1241,15 @@ func GetGroupPostsHandler(db *sql.DB) http.HandlerFunc {
 		defer rows.Close()
 
 		// Prepare a slice to hold the posts.
-		var posts []map[string]string
+		var posts []map[string]interface{}
+		var postIDs []string
 		for rows.Next() {
 			var id, creatorID, content, imageURL, createdAt, nickname, avatar string
 			if err := rows.Scan(&id, &creatorID, &content, &imageURL, &createdAt, &nickname, &avatar); err != nil {
 				http.Error(w, "Failed to parse posts", http.StatusInternalServerError)
 				return
 			}
-			post := map[string]string{
+			post := map[string]interface{}{
 				"id":         id,
 				"user_id":    creatorID,
 				"content":    content,
@@ -1174,6 +1259,19 @@ func GetGroupPostsHandler(db *sql.DB) http.HandlerFunc {
 				"avatar":     avatar,
 			}
 			posts = append(posts, post)
+			postIDs = append(postIDs, id)
+		}
+
+		// Attach the mentions of each post
+		found, err := mentions.Load(db, "group_post", postIDs)
+		if err != nil {
+			http.Error(w, "Failed to fetch mentions", http.StatusInternalServerError)
+			return
+		}
+		for i, id := range postIDs {
+			if entities, ok := found[id]; ok {
+				posts[i]["entities"] = entities
+			}
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -1190,7 +1288,7 @@ func CreateGroupPostCommentHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		// Get user ID from session
-		userID, err := sessions.GetUserIDFromSession(r)
+		userID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
@@ -1225,7 +1323,21 @@ func CreateGroupPostCommentHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		w.Write([]byte("Comment added successfully"))
+		// Link and notify the members mentioned in the comment
+		var groupID string
+		db.QueryRow(`SELECT group_id FROM group_posts WHERE id = ?`, request.PostID).Scan(&groupID)
+		entities, err := mentions.Process(db, mentions.Content{Type: "group_post_comment", ID: commentID, AuthorID: userID, GroupID: groupID}, request.Content)
+		if err != nil {
+			log.Printf("Failed to process mentions for group comment %s: %v", commentID, err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":    "Comment added successfully",
+			"comment_id": commentID,
+			"content":    request.Content,
+			"entities":   entities,
+		})
 	}
 }
 
@@ -1244,29 +1356,35 @@ func GetGroupPostCommentsHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		// Comments from accounts muted by the viewer are hidden unless show_muted=true is passed
+		viewerID, _ := sessions.UserIDFromContext(r.Context())
+		showMuted := r.URL.Query().Get("show_muted") == "true"
+
 		// Fetch comments for the group post
 		rows, err := db.Query(`
 			SELECT c.id, c.post_id, c.user_id, c.content, c.created_at, u.nickname, u.avatar
 			FROM group_post_comments c
 			INNER JOIN users u ON c.user_id = u.id
-			WHERE c.post_id = ?
+			WHERE c.post_id = ? AND c.hidden = 0
+			AND (? OR NOT EXISTS(SELECT 1 FROM muted_users WHERE user_id = ? AND muted_user_id = c.user_id))
 			ORDER BY c.created_at ASC
-		`, postID)
+		`, postID, showMuted, viewerID)
 		if err != nil {
 			http.Error(w, "Failed to fetch comments", http.StatusInternalServerError)
 			return
 		}
 		defer rows.Close()
 
-		var comments []map[string]string
+		var comments []map[string]interface{}
+		var commentIDs []string
 		for rows.Next() {
-			var comment map[string]string
+			var comment map[string]interface{}
 			var id, postID, userID, content, createdAt, nickname, avatar string
 			if err := rows.Scan(&id, &postID, &userID, &content, &createdAt, &nickname, &avatar); err != nil {
 				http.Error(w, "Failed to parse comments", http.StatusInternalServerError)
 				return
 			}
-			comment = map[string]string{
+			comment = map[string]interface{}{
 				"id":         id,
 				"post_id":    postID,
 				"user_id":    userID,
@@ -1276,6 +1394,19 @@ func GetGroupPostCommentsHandler(db *sql.DB) http.HandlerFunc {
 				"avatar":     avatar,
 			}
 			comments = append(comments, comment)
+			commentIDs = append(commentIDs, id)
+		}
+
+		// Attach the mentions of each comment
+		found, err := mentions.Load(db, "group_post_comment", commentIDs)
+		if err != nil {
+			http.Error(w, "Failed to fetch mentions", http.StatusInternalServerError)
+			return
+		}
+		for i, id := range commentIDs {
+			if entities, ok := found[id]; ok {
+				comments[i]["entities"] = entities
+			}
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -1292,7 +1423,7 @@ func DeleteGroupPostCommentHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		// Get user ID from session
-		userID, err := sessions.GetUserIDFromSession(r)
+		userID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
@@ -1322,12 +1453,27 @@ func DeleteGroupPostCommentHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Delete the comment
-		_, err = db.Exec(`DELETE FROM group_post_comments WHERE id = ?`, commentID)
+		// Delete the comment and its mentions together
+		queries := []string{
+			`DELETE FROM mentions WHERE content_type = 'group_post_comment' AND content_id = ?`,
+			`DELETE FROM group_post_comments WHERE id = ?`,
+		}
+		tx, err := db.Begin()
 		if err != nil {
 			http.Error(w, "Failed to delete comment", http.StatusInternalServerError)
 			return
 		}
+		defer tx.Rollback()
+		for _, query := range queries {
+			if _, err := tx.Exec(query, commentID); err != nil {
+				http.Error(w, "Failed to delete comment", http.StatusInternalServerError)
+				return
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to delete comment", http.StatusInternalServerError)
+			return
+		}
 
 		w.Write([]byte("Comment deleted successfully"))
 	}
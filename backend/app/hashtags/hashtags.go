@@ -0,0 +1,300 @@
+package hashtags
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"social-network/app/mentions"
+	"social-network/app/sessions"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// maxTags is how many different hashtags one post can be indexed under
+	maxTags = 10
+	// maxTagLength is the longest hashtag indexed, in characters
+	maxTagLength = 50
+)
+
+// tagPattern matches a #hashtag that is not part of a longer word, a URL fragment or an HTML entity
+var tagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_#&/])#([\p{L}\p{N}_]+)`)
+
+// validTag reports whether tag (without the #) can be indexed: not too long and not only digits
+// or underscores, so "#1" is not a tag
+func validTag(tag string) bool {
+	if tag == "" || utf8.RuneCountInString(tag) > maxTagLength {
+		return false
+	}
+	for _, r := range tag {
+		if unicode.IsLetter(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// Extract returns the different hashtags in text, lowercased and without the #, in order of
+// first use. At most maxTags are returned.
+func Extract(text string) []string {
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, match := range tagPattern.FindAllStringSubmatch(text, -1) {
+		tag := strings.ToLower(match[1])
+		if !validTag(tag) || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+		if len(tags) == maxTags {
+			break
+		}
+	}
+	return tags
+}
+
+// Save indexes the hashtags of a new post or group post and returns them
+func Save(db *sql.DB, contentType, contentID, text string) ([]string, error) {
+	tags := Extract(text)
+	for _, tag := range tags {
+		_, err := db.Exec(`INSERT OR IGNORE INTO hashtags (id, content_type, content_id, tag) VALUES (?, ?, ?, ?)`,
+			uuid.New().String(), contentType, contentID, tag)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tags, nil
+}
+
+// Delete removes a post that is being deleted from the index
+func Delete(db *sql.DB, contentType, contentID string) error {
+	_, err := db.Exec(`DELETE FROM hashtags WHERE content_type = ? AND content_id = ?`, contentType, contentID)
+	return err
+}
+
+// TaggedPost is a post or group post in a hashtag feed
+type TaggedPost struct {
+	Type      string            `json:"type"` // "post" or "group_post"
+	ID        string            `json:"id"`
+	GroupID   string            `json:"group_id,omitempty"`
+	UserID    string            `json:"user_id"`
+	Nickname  string            `json:"nickname"`
+	Avatar    string            `json:"avatar"`
+	Content   string            `json:"content"`
+	ImageURL  string            `json:"image_url,omitempty"`
+	Privacy   string            `json:"privacy,omitempty"`
+	CreatedAt string            `json:"created_at"`
+	Entities  []mentions.Entity `json:"entities,omitempty"`
+}
+
+// tagFeedQuery lists the posts tagged ?1 that user ?2 can see, newest first: posts allowed by their
+// privacy setting and posts in groups the user is a member of. Authors with a block either way are
+// left out, and muted accounts and keywords too unless ?3 is true. ?4 and ?5 are the limit and offset.
+const tagFeedQuery = `
+	SELECT 'post' AS type, p.id, '' AS group_id, p.user_id, u.nickname, u.avatar, p.content, p.image_url, p.privacy, p.created_at AS created_at
+	FROM hashtags h
+	JOIN posts p ON p.id = h.content_id
+	JOIN users u ON u.id = p.user_id
+	WHERE h.content_type = 'post' AND h.tag = ?1
+	AND p.hidden = 0
+	AND (
+		p.privacy = 'public'
+		OR p.user_id = ?2
+		OR (p.privacy = 'almost-private' AND EXISTS(
+		    SELECT 1 FROM followers WHERE follower_id = ?2 AND followed_id = p.user_id AND status = 'accepted'
+		))
+		OR (p.privacy = 'private' AND (EXISTS(
+		    SELECT 1 FROM post_privacy WHERE post_id = p.id AND user_id = ?2
+		) OR EXISTS(
+		    SELECT 1 FROM post_audiences
+		    JOIN audience_members ON audience_members.audience_id = post_audiences.audience_id
+		    WHERE post_audiences.post_id = p.id AND audience_members.user_id = ?2
+		)))
+	)
+	AND NOT EXISTS(
+	    SELECT 1 FROM blocks
+	    WHERE (blocker_id = p.user_id AND blocked_id = ?2)
+	       OR (blocker_id = ?2 AND blocked_id = p.user_id)
+	)
+	AND (?3 OR (
+	    NOT EXISTS(SELECT 1 FROM muted_users WHERE user_id = ?2 AND muted_user_id = p.user_id)
+	    AND (p.user_id = ?2 OR NOT EXISTS(
+	        SELECT 1 FROM muted_keywords WHERE user_id = ?2 AND instr(fold_case(p.content), keyword) > 0
+	    ))
+	))
+
+	UNION ALL
+
+	SELECT 'group_post', gp.id, gp.group_id, gp.user_id, u.nickname, u.avatar, gp.content, gp.image_url, '', gp.created_at
+	FROM hashtags h
+	JOIN group_posts gp ON gp.id = h.content_id
+	JOIN users u ON u.id = gp.user_id
+	WHERE h.content_type = 'group_post' AND h.tag = ?1
+	AND gp.hidden = 0
+	AND EXISTS(
+	    SELECT 1 FROM group_membership WHERE group_id = gp.group_id AND user_id = ?2 AND status = 'member'
+	)
+	AND NOT EXISTS(
+	    SELECT 1 FROM blocks
+	    WHERE (blocker_id = gp.user_id AND blocked_id = ?2)
+	       OR (blocker_id = ?2 AND blocked_id = gp.user_id)
+	)
+	AND (?3 OR (
+	    NOT EXISTS(SELECT 1 FROM muted_users WHERE user_id = ?2 AND muted_user_id = gp.user_id)
+	    AND (gp.user_id = ?2 OR NOT EXISTS(
+	        SELECT 1 FROM muted_keywords WHERE user_id = ?2 AND instr(fold_case(gp.content), keyword) > 0
+	    ))
+	))
+
+	ORDER BY created_at DESC
+	LIMIT ?4 OFFSET ?5
+`
+
+// GetTagFeedHandler lists the posts and group posts tagged with a hashtag that the logged-in user
+// can see, newest first
+func GetTagFeedHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		tag := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(r.URL.Query().Get("tag")), "#"))
+		if !validTag(tag) {
+			http.Error(w, "Invalid or missing tag", http.StatusBadRequest)
+			return
+		}
+
+		limit := 20
+		if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 50 {
+			limit = l
+		}
+		page := 1
+		if p, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && p > 0 {
+			page = p
+		}
+		showMuted := r.URL.Query().Get("show_muted") == "true"
+
+		rows, err := db.Query(tagFeedQuery, tag, userID, showMuted, limit, (page-1)*limit)
+		if err != nil {
+			http.Error(w, "Failed to fetch posts", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		posts := []TaggedPost{}
+		idsByType := map[string][]string{}
+		for rows.Next() {
+			var post TaggedPost
+			if err := rows.Scan(&post.Type, &post.ID, &post.GroupID, &post.UserID, &post.Nickname, &post.Avatar,
+				&post.Content, &post.ImageURL, &post.Privacy, &post.CreatedAt); err != nil {
+				http.Error(w, "Failed to parse posts", http.StatusInternalServerError)
+				return
+			}
+			posts = append(posts, post)
+			idsByType[post.Type] = append(idsByType[post.Type], post.ID)
+		}
+
+		// Attach the mentions of each post
+		for contentType, ids := range idsByType {
+			found, err := mentions.Load(db, contentType, ids)
+			if err != nil {
+				http.Error(w, "Failed to fetch mentions", http.StatusInternalServerError)
+				return
+			}
+			for i := range posts {
+				if posts[i].Type == contentType {
+					posts[i].Entities = found[posts[i].ID]
+				}
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"tag":   tag,
+			"posts": posts,
+			"page":  page,
+			"limit": limit,
+		})
+	}
+}
+
+// TrendingTag is a hashtag with its use over the trending window
+type TrendingTag struct {
+	Tag          string `json:"tag"`
+	PostsCount   int    `json:"posts_count"`
+	AuthorsCount int    `json:"authors_count"`
+}
+
+// trendingTagsQuery ranks the hashtags of public posts created since ?1 by how many different
+// people used them, then by how many posts did. Group posts and posts limited to followers or
+// audiences never count, nor do hidden posts and suspended authors.
+const trendingTagsQuery = `
+	SELECT h.tag, COUNT(*) AS posts_count, COUNT(DISTINCT p.user_id) AS authors_count
+	FROM hashtags h
+	JOIN posts p ON p.id = h.content_id
+	JOIN users u ON u.id = p.user_id
+	WHERE h.content_type = 'post'
+	AND p.privacy = 'public'
+	AND p.hidden = 0
+	AND COALESCE(u.suspended, 0) = 0
+	AND p.created_at > datetime('now', ?1)
+	GROUP BY h.tag
+	ORDER BY authors_count DESC, posts_count DESC, MAX(p.created_at) DESC
+	LIMIT ?2
+`
+
+// GetTrendingTagsHandler returns the most used hashtags in public posts over the last hours
+// (24 by default, at most a week)
+func GetTrendingTagsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		hours := 24
+		if h, err := strconv.Atoi(r.URL.Query().Get("hours")); err == nil && h > 0 && h <= 7*24 {
+			hours = h
+		}
+		limit := 10
+		if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 50 {
+			limit = l
+		}
+
+		rows, err := db.Query(trendingTagsQuery, fmt.Sprintf("-%d hours", hours), limit)
+		if err != nil {
+			http.Error(w, "Failed to fetch trending tags", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		tags := []TrendingTag{}
+		for rows.Next() {
+			var tag TrendingTag
+			if err := rows.Scan(&tag.Tag, &tag.PostsCount, &tag.AuthorsCount); err != nil {
+				http.Error(w, "Failed to parse trending tags", http.StatusInternalServerError)
+				return
+			}
+			tags = append(tags, tag)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"hours": hours,
+			"tags":  tags,
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"net/http"
+	"social-network/app/blocks"
 	"social-network/app/notifications"
 	"social-network/app/sessions"
 
@@ -26,7 +27,7 @@ func AddLikeHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		// Retrieve the user_id associated with the session.
-		userID, err := sessions.GetUserIDFromSession(r)
+		userID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
@@ -51,6 +52,25 @@ func AddLikeHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		// Fetch the owner of the post.
+		var postOwnerID string
+		err = db.QueryRow(`SELECT user_id FROM posts WHERE id = ?`, postID).Scan(&postOwnerID)
+		if err != nil {
+			http.Error(w, "Failed to retrieve post owner", http.StatusInternalServerError)
+			return
+		}
+
+		// Blocked users cannot like each other's posts.
+		blocked, err := blocks.IsBlocked(db, userID, postOwnerID)
+		if err != nil {
+			http.Error(w, "Failed to check block status", http.StatusInternalServerError)
+			return
+		}
+		if blocked {
+			http.Error(w, "You cannot like this post", http.StatusForbidden)
+			return
+		}
+
 		// Generate a unique ID for the like.
 		likeID := uuid.New().String()
 
@@ -65,14 +85,6 @@ func AddLikeHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Fetch the owner of the post.
-		var postOwnerID string
-		err = db.QueryRow(`SELECT user_id FROM posts WHERE id = ?`, postID).Scan(&postOwnerID)
-		if err != nil {
-			http.Error(w, "Failed to retrieve post owner", http.StatusInternalServerError)
-			return
-		}
-
 		// Only create a notification if the liker is not the post owner.
 		if userID != postOwnerID {
 			// Retrieve the nickname of the liker.
@@ -112,7 +124,7 @@ func RemoveLikeHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		// Query the database to retrieve the user_id associated with the session.
-		userID, _ := sessions.GetUserIDFromSession(r)
+		userID, _ := sessions.UserIDFromContext(r.Context())
 
 		// Extract post_id from query params.
 		postID := r.URL.Query().Get("post_id")
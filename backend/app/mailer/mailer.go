@@ -0,0 +1,95 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Mailer sends plain-text emails
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// SMTPMailer delivers emails through an SMTP server
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send delivers the message over SMTP, authenticating when credentials are configured
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	return smtp.SendMail(m.Host+":"+m.Port, auth, m.From, []string{to}, buildMessage(m.From, to, subject, body))
+}
+
+// FileMailer writes each email to a file in Dir, or to the log when Dir is empty.
+// It is meant for local development and tests.
+type FileMailer struct {
+	Dir string
+}
+
+// Send stores the message instead of delivering it
+func (m *FileMailer) Send(to, subject, body string) error {
+	message := buildMessage("no-reply@localhost", to, subject, body)
+	if m.Dir == "" {
+		log.Printf("Email to %s:\n%s", to, message)
+		return nil
+	}
+
+	if err := os.MkdirAll(m.Dir, os.ModePerm); err != nil {
+		return err
+	}
+	filename := fmt.Sprintf("%s_%s.eml", time.Now().Format("20060102T150405"), uuid.New().String())
+	return os.WriteFile(filepath.Join(m.Dir, filename), message, 0o644)
+}
+
+// FromEnv builds an SMTPMailer when SMTP_HOST is set and a FileMailer writing to MAIL_DIR otherwise
+func FromEnv() Mailer {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return &FileMailer{Dir: os.Getenv("MAIL_DIR")}
+	}
+
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		from = "no-reply@" + host
+	}
+	return &SMTPMailer{
+		Host:     host,
+		Port:     port,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     from,
+	}
+}
+
+// buildMessage formats an RFC 5322 message with the given headers and body
+func buildMessage(from, to, subject, body string) []byte {
+	var sb strings.Builder
+	sb.WriteString("From: " + from + "\r\n")
+	sb.WriteString("To: " + to + "\r\n")
+	sb.WriteString("Subject: " + subject + "\r\n")
+	sb.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	sb.WriteString("MIME-Version: 1.0\r\n")
+	sb.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	sb.WriteString("\r\n")
+	sb.WriteString(body)
+	return []byte(sb.String())
+}
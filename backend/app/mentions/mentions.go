@@ -0,0 +1,273 @@
+package mentions
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"social-network/app/blocks"
+	"social-network/app/notifications"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// maxMentions is how many different users one piece of content can mention
+const maxMentions = 10
+
+// mentionPattern matches an @handle that is not part of a longer word or an email address. The
+// handle follows the nickname rules: letters and numbers, up to 15 characters.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])(@([a-zA-Z0-9]{1,15}))\b`)
+
+// Entity is a mention in a piece of text. Offset and Length count characters (Unicode code
+// points) and cover the whole @handle.
+type Entity struct {
+	Type     string `json:"type"` // Always "mention"
+	UserID   string `json:"user_id"`
+	Nickname string `json:"nickname"` // The handle as written, without the @
+	Offset   int    `json:"offset"`
+	Length   int    `json:"length"`
+}
+
+// Content identifies the text mentions are made in
+type Content struct {
+	Type     string // One of the keys of contentKinds
+	ID       string
+	AuthorID string
+	PostID   string // Post notifications link to, for posts and comments
+	GroupID  string // Group notifications link to, for group content
+}
+
+// contentKind describes a type of content users can be mentioned in
+type contentKind struct {
+	Label     string // How notifications refer to it
+	VisibleTo string // Query reporting whether user ?2 can see the content ?1
+}
+
+// postVisibleTo is true when user ?2 can see post p under its privacy setting, like in the feed
+const postVisibleTo = `p.hidden = 0 AND (
+	p.privacy = 'public'
+	OR p.user_id = ?2
+	OR (p.privacy = 'almost-private' AND EXISTS(
+	    SELECT 1 FROM followers WHERE follower_id = ?2 AND followed_id = p.user_id AND status = 'accepted'
+	))
+	OR (p.privacy = 'private' AND (EXISTS(
+	    SELECT 1 FROM post_privacy WHERE post_id = p.id AND user_id = ?2
+	) OR EXISTS(
+	    SELECT 1 FROM post_audiences
+	    JOIN audience_members ON audience_members.audience_id = post_audiences.audience_id
+	    WHERE post_audiences.post_id = p.id AND audience_members.user_id = ?2
+	)))
+)`
+
+// memberOf is true when user ?2 is a member of the group in the given column
+func memberOf(groupColumn string) string {
+	return `EXISTS(SELECT 1 FROM group_membership WHERE group_id = ` + groupColumn + ` AND user_id = ?2 AND status = 'member')`
+}
+
+// contentKinds maps each content type mentions are parsed in to how it is shown and who can see it
+var contentKinds = map[string]contentKind{
+	"post": {
+		Label:     "a post",
+		VisibleTo: `SELECT EXISTS(SELECT 1 FROM posts p WHERE p.id = ?1 AND ` + postVisibleTo + `)`,
+	},
+	"comment": {
+		Label: "a comment",
+		VisibleTo: `SELECT EXISTS(SELECT 1 FROM comments c JOIN posts p ON p.id = c.post_id
+			WHERE c.id = ?1 AND c.hidden = 0 AND ` + postVisibleTo + `)`,
+	},
+	"group_post": {
+		Label: "a group post",
+		VisibleTo: `SELECT EXISTS(SELECT 1 FROM group_posts gp
+			WHERE gp.id = ?1 AND gp.hidden = 0 AND ` + memberOf("gp.group_id") + `)`,
+	},
+	"group_post_comment": {
+		Label: "a comment on a group post",
+		VisibleTo: `SELECT EXISTS(SELECT 1 FROM group_post_comments c JOIN group_posts gp ON gp.id = c.post_id
+			WHERE c.id = ?1 AND c.hidden = 0 AND gp.hidden = 0 AND ` + memberOf("gp.group_id") + `)`,
+	},
+	"group_chat_message": {
+		Label: "a group chat message",
+		VisibleTo: `SELECT EXISTS(SELECT 1 FROM group_chat_messages m
+			WHERE m.id = ?1 AND m.hidden = 0 AND ` + memberOf("m.group_id") + `)`,
+	},
+	"private_chat_message": {
+		Label: "a private message",
+		VisibleTo: `SELECT EXISTS(SELECT 1 FROM private_chat_messages m
+			WHERE m.id = ?1 AND m.hidden = 0 AND ?2 IN (m.sender_id, m.receiver_id))`,
+	},
+}
+
+// Extract finds the @handles in text, in order. The returned entities have no user yet.
+func Extract(text string) []Entity {
+	var entities []Entity
+	for _, match := range mentionPattern.FindAllStringSubmatchIndex(text, -1) {
+		start, end := match[2], match[3]
+		entities = append(entities, Entity{
+			Type:     "mention",
+			Nickname: text[match[4]:match[5]],
+			Offset:   utf8.RuneCountInString(text[:start]),
+			Length:   utf8.RuneCountInString(text[start:end]),
+		})
+	}
+	return entities
+}
+
+// resolve fills in the user each handle leads to and drops handles that lead nowhere. Like
+// users.ResolveNickname, a handle is its current owner's or, failing that, belongs to the account
+// that gave it up within the grace period. At most maxMentions different users are kept.
+func resolve(db *sql.DB, entities []Entity) ([]Entity, error) {
+	if len(entities) == 0 {
+		return nil, nil
+	}
+
+	var handles []interface{}
+	seen := map[string]bool{}
+	for _, entity := range entities {
+		if !seen[entity.Nickname] {
+			seen[entity.Nickname] = true
+			handles = append(handles, entity.Nickname)
+		}
+	}
+
+	rows, err := db.Query(`
+		WITH handles(nickname) AS (VALUES (?)`+strings.Repeat(", (?)", len(handles)-1)+`)
+		SELECT handles.nickname, COALESCE(
+			(SELECT id FROM users WHERE nickname = handles.nickname),
+			(SELECT user_id FROM nickname_history
+			 WHERE nickname = handles.nickname AND reserved_until > CURRENT_TIMESTAMP
+			 ORDER BY changed_at DESC LIMIT 1)
+		)
+		FROM handles`, handles...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	userIDs := map[string]string{}
+	for rows.Next() {
+		var nickname string
+		var userID sql.NullString
+		if err := rows.Scan(&nickname, &userID); err != nil {
+			return nil, err
+		}
+		if userID.Valid {
+			userIDs[nickname] = userID.String
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var resolved []Entity
+	mentioned := map[string]bool{}
+	for _, entity := range entities {
+		userID, ok := userIDs[entity.Nickname]
+		if !ok || (!mentioned[userID] && len(mentioned) == maxMentions) {
+			continue
+		}
+		mentioned[userID] = true
+		entity.UserID = userID
+		resolved = append(resolved, entity)
+	}
+	return resolved, nil
+}
+
+// Process finds the mentions in text, stores them for the content and notifies every mentioned
+// user who can see the content and has no block with its author. It returns the stored mentions.
+func Process(db *sql.DB, content Content, text string) ([]Entity, error) {
+	kind, ok := contentKinds[content.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown content type %q", content.Type)
+	}
+
+	entities, err := resolve(db, Extract(text))
+	if err != nil {
+		return nil, err
+	}
+	if len(entities) == 0 {
+		return []Entity{}, nil
+	}
+
+	for _, entity := range entities {
+		_, err := db.Exec(`
+			INSERT INTO mentions (id, content_type, content_id, author_id, mentioned_user_id, nickname, start_offset, length)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			uuid.New().String(), content.Type, content.ID, content.AuthorID, entity.UserID, entity.Nickname, entity.Offset, entity.Length)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var authorNickname string
+	if err := db.QueryRow(`SELECT nickname FROM users WHERE id = ?`, content.AuthorID).Scan(&authorNickname); err != nil {
+		authorNickname = "Someone"
+	}
+
+	notified := map[string]bool{content.AuthorID: true}
+	for _, entity := range entities {
+		if notified[entity.UserID] {
+			continue
+		}
+		notified[entity.UserID] = true
+
+		var visible bool
+		if err := db.QueryRow(kind.VisibleTo, content.ID, entity.UserID).Scan(&visible); err != nil {
+			return entities, err
+		}
+		blocked, err := blocks.IsBlocked(db, content.AuthorID, entity.UserID)
+		if err != nil {
+			return entities, err
+		}
+		if !visible || blocked {
+			continue
+		}
+
+		err = notifications.CreateNotification(
+			db,
+			entity.UserID,
+			"mention",
+			fmt.Sprintf("%s mentioned you in %s", authorNickname, kind.Label),
+			content.PostID,
+			content.AuthorID, // relatedUserID: who wrote the mention
+			content.GroupID,
+			"",
+		)
+		if err != nil {
+			return entities, err
+		}
+	}
+	return entities, nil
+}
+
+// Load returns the stored mentions of the given pieces of content of one type, keyed by content ID
+func Load(db *sql.DB, contentType string, contentIDs []string) (map[string][]Entity, error) {
+	found := map[string][]Entity{}
+	if len(contentIDs) == 0 {
+		return found, nil
+	}
+
+	args := []interface{}{contentType}
+	for _, id := range contentIDs {
+		args = append(args, id)
+	}
+	rows, err := db.Query(`
+		SELECT content_id, mentioned_user_id, nickname, start_offset, length
+		FROM mentions
+		WHERE content_type = ? AND content_id IN (?`+strings.Repeat(", ?", len(contentIDs)-1)+`)
+		ORDER BY content_id, start_offset`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var contentID string
+		entity := Entity{Type: "mention"}
+		if err := rows.Scan(&contentID, &entity.UserID, &entity.Nickname, &entity.Offset, &entity.Length); err != nil {
+			return nil, err
+		}
+		found[contentID] = append(found[contentID], entity)
+	}
+	return found, rows.Err()
+}
@@ -0,0 +1,521 @@
+package moderation
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"social-network/app/sessions"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Report represents a user report as seen in the moderation queue
+type Report struct {
+	ID               string `json:"id"`
+	ReporterID       string `json:"reporter_id"`
+	ReporterNickname string `json:"reporter_nickname"`
+	ContentType      string `json:"content_type"`
+	ContentID        string `json:"content_id"`
+	ReportedUserID   string `json:"reported_user_id"`
+	ReportedNickname string `json:"reported_nickname"`
+	Reason           string `json:"reason"`
+	Details          string `json:"details,omitempty"`
+	Status           string `json:"status"`
+	ResolvedBy       string `json:"resolved_by,omitempty"`
+	ResolvedAt       string `json:"resolved_at,omitempty"`
+	CreatedAt        string `json:"created_at"`
+}
+
+// Action represents an entry in the moderation audit trail
+type Action struct {
+	ID                string `json:"id"`
+	ModeratorID       string `json:"moderator_id,omitempty"` // Empty once the moderator's account is deleted
+	ModeratorNickname string `json:"moderator_nickname,omitempty"`
+	Action            string `json:"action"`
+	ContentType       string `json:"content_type,omitempty"`
+	ContentID         string `json:"content_id,omitempty"`
+	TargetUserID      string `json:"target_user_id,omitempty"`
+	ReportID          string `json:"report_id,omitempty"`
+	Note              string `json:"note,omitempty"`
+	CreatedAt         string `json:"created_at"`
+}
+
+// requireOutranks writes an error and returns false unless the logged-in staff member holds a
+// higher role than the target user, so moderators cannot act against other moderators or admins
+func requireOutranks(db *sql.DB, w http.ResponseWriter, r *http.Request, targetUserID string) bool {
+	staff, ok := sessions.UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+
+	outranks, err := Outranks(db, staff, targetUserID)
+	if err == ErrContentNotFound {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return false
+	} else if err != nil {
+		http.Error(w, "Failed to check user role", http.StatusInternalServerError)
+		return false
+	}
+	if !outranks {
+		http.Error(w, "Forbidden: you cannot act on users with an equal or higher role", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// CreateReportHandler lets any user report a post, comment, group post, chat message or user
+func CreateReportHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var request struct {
+			ContentType string `json:"content_type"`
+			ContentID   string `json:"content_id"`
+			Reason      string `json:"reason"`
+			Details     string `json:"details,omitempty"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if request.ContentType == "" || request.ContentID == "" {
+			http.Error(w, "Missing content_type or content_id", http.StatusBadRequest)
+			return
+		}
+		if !contains(reportReasons, request.Reason) {
+			http.Error(w, "Invalid reason. Allowed: "+strings.Join(reportReasons, ", "), http.StatusBadRequest)
+			return
+		}
+		if len(request.Details) > 500 {
+			http.Error(w, "Details cannot exceed 500 characters", http.StatusBadRequest)
+			return
+		}
+
+		reportedUserID, err := ContentOwner(db, request.ContentType, request.ContentID)
+		if err == ErrUnknownContentType {
+			http.Error(w, "Invalid content_type", http.StatusBadRequest)
+			return
+		} else if err == ErrContentNotFound {
+			http.Error(w, "Content not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to look up content", http.StatusInternalServerError)
+			return
+		}
+
+		if reportedUserID == userID {
+			http.Error(w, "You cannot report your own content", http.StatusBadRequest)
+			return
+		}
+
+		// Private messages may only be reported by their recipient
+		if request.ContentType == "private_chat_message" {
+			var isRecipient bool
+			err = db.QueryRow(`SELECT EXISTS(SELECT 1 FROM private_chat_messages WHERE id = ? AND receiver_id = ?)`,
+				request.ContentID, userID).Scan(&isRecipient)
+			if err != nil || !isRecipient {
+				http.Error(w, "Content not found", http.StatusNotFound)
+				return
+			}
+		}
+
+		// Avoid duplicate open reports from the same user
+		var alreadyReported bool
+		err = db.QueryRow(`
+			SELECT EXISTS(SELECT 1 FROM reports WHERE reporter_id = ? AND content_type = ? AND content_id = ? AND status = 'open')
+		`, userID, request.ContentType, request.ContentID).Scan(&alreadyReported)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if alreadyReported {
+			http.Error(w, "You have already reported this content", http.StatusConflict)
+			return
+		}
+
+		reportID := uuid.New().String()
+		_, err = db.Exec(`
+			INSERT INTO reports (id, reporter_id, content_type, content_id, reported_user_id, reason, details)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, reportID, userID, request.ContentType, request.ContentID, reportedUserID, request.Reason, request.Details)
+		if err != nil {
+			log.Printf("Error creating report: %v", err)
+			http.Error(w, "Failed to create report", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{
+			"message":   "Report submitted successfully",
+			"report_id": reportID,
+		})
+	}
+}
+
+// GetReportsHandler returns the moderation queue, filtered by status (open by default)
+func GetReportsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		status := r.URL.Query().Get("status")
+		if status == "" {
+			status = "open"
+		} else if status != "open" && status != "actioned" && status != "dismissed" {
+			http.Error(w, "Invalid status, must be 'open', 'actioned' or 'dismissed'", http.StatusBadRequest)
+			return
+		}
+
+		rows, err := db.Query(`
+			SELECT r.id, r.reporter_id, reporter.nickname, r.content_type, r.content_id,
+			       r.reported_user_id, reported.nickname, r.reason, COALESCE(r.details, ''), r.status,
+			       COALESCE(r.resolved_by, ''), COALESCE(r.resolved_at, ''), r.created_at
+			FROM reports r
+			JOIN users reporter ON reporter.id = r.reporter_id
+			JOIN users reported ON reported.id = r.reported_user_id
+			WHERE r.status = ?
+			ORDER BY r.created_at ASC
+		`, status)
+		if err != nil {
+			http.Error(w, "Failed to fetch reports", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		var reports []Report
+		for rows.Next() {
+			var report Report
+			if err := rows.Scan(
+				&report.ID, &report.ReporterID, &report.ReporterNickname, &report.ContentType, &report.ContentID,
+				&report.ReportedUserID, &report.ReportedNickname, &report.Reason, &report.Details, &report.Status,
+				&report.ResolvedBy, &report.ResolvedAt, &report.CreatedAt,
+			); err != nil {
+				http.Error(w, "Failed to parse reports", http.StatusInternalServerError)
+				return
+			}
+			reports = append(reports, report)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(reports)
+	}
+}
+
+// ResolveReportHandler closes an open report by hiding the content, suspending its author, or dismissing it.
+// Every other open report against the same content is closed with the same outcome.
+func ResolveReportHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// The moderator is placed in the context by auth.AuthMiddleware
+		moderatorID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var request struct {
+			ReportID string `json:"report_id"`
+			Action   string `json:"action"` // "hide_content", "suspend_user" or "dismiss"
+			Note     string `json:"note,omitempty"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		var contentType, contentID, reportedUserID, status string
+		err = db.QueryRow(`SELECT content_type, content_id, reported_user_id, status FROM reports WHERE id = ?`,
+			request.ReportID).Scan(&contentType, &contentID, &reportedUserID, &status)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Report not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to fetch report", http.StatusInternalServerError)
+			return
+		}
+		if status != "open" {
+			http.Error(w, "Report has already been resolved", http.StatusConflict)
+			return
+		}
+
+		var newStatus, auditAction string
+		switch request.Action {
+		case "hide_content":
+			if contentType == "user" {
+				http.Error(w, "User reports cannot be hidden; suspend the user instead", http.StatusBadRequest)
+				return
+			}
+			if !requireOutranks(db, w, r, reportedUserID) {
+				return
+			}
+			newStatus, auditAction = "actioned", "hide_content"
+		case "suspend_user":
+			if !requireOutranks(db, w, r, reportedUserID) {
+				return
+			}
+			newStatus, auditAction = "actioned", "suspend_user"
+		case "dismiss":
+			newStatus, auditAction = "dismissed", "dismiss_report"
+		default:
+			http.Error(w, "Invalid action, must be 'hide_content', 'suspend_user' or 'dismiss'", http.StatusBadRequest)
+			return
+		}
+
+		// The action, the reports it closes and its audit entry are recorded together
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Failed to update report", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		switch request.Action {
+		case "hide_content":
+			if err := SetContentHidden(tx, contentType, contentID, true); err != nil {
+				http.Error(w, "Failed to hide content", http.StatusInternalServerError)
+				return
+			}
+		case "suspend_user":
+			if err := SetUserSuspended(tx, reportedUserID, true); err != nil {
+				http.Error(w, "Failed to suspend user", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		_, err = tx.Exec(`
+			UPDATE reports SET status = ?, resolved_by = ?, resolved_at = CURRENT_TIMESTAMP
+			WHERE content_type = ? AND content_id = ? AND status = 'open'
+		`, newStatus, moderatorID, contentType, contentID)
+		if err != nil {
+			http.Error(w, "Failed to update report", http.StatusInternalServerError)
+			return
+		}
+
+		if err := LogAction(tx, moderatorID, auditAction, contentType, contentID, reportedUserID, request.ReportID, request.Note); err != nil {
+			http.Error(w, "Failed to record moderation action", http.StatusInternalServerError)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to update report", http.StatusInternalServerError)
+			return
+		}
+
+		w.Write([]byte("Report " + newStatus + " successfully"))
+	}
+}
+
+// HideContentHandler lets a moderator hide or restore content directly, without a report
+func HideContentHandler(db *sql.DB, hidden bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// The moderator is placed in the context by auth.AuthMiddleware
+		moderatorID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var request struct {
+			ContentType string `json:"content_type"`
+			ContentID   string `json:"content_id"`
+			Note        string `json:"note,omitempty"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		ownerID, err := ContentOwner(db, request.ContentType, request.ContentID)
+		if err == ErrUnknownContentType || request.ContentType == "user" {
+			http.Error(w, "Invalid content_type", http.StatusBadRequest)
+			return
+		} else if err == ErrContentNotFound {
+			http.Error(w, "Content not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to look up content", http.StatusInternalServerError)
+			return
+		}
+
+		// Moderators cannot hide or restore content by other moderators or admins
+		if !requireOutranks(db, w, r, ownerID) {
+			return
+		}
+
+		// The change and its audit entry are recorded together
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Failed to update content visibility", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		if err := SetContentHidden(tx, request.ContentType, request.ContentID, hidden); err != nil {
+			http.Error(w, "Failed to update content visibility", http.StatusInternalServerError)
+			return
+		}
+
+		action := "unhide_content"
+		if hidden {
+			action = "hide_content"
+		}
+		if err := LogAction(tx, moderatorID, action, request.ContentType, request.ContentID, ownerID, "", request.Note); err != nil {
+			http.Error(w, "Failed to record moderation action", http.StatusInternalServerError)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to update content visibility", http.StatusInternalServerError)
+			return
+		}
+
+		if hidden {
+			w.Write([]byte("Content hidden successfully"))
+		} else {
+			w.Write([]byte("Content restored successfully"))
+		}
+	}
+}
+
+// SuspendUserHandler lets a moderator suspend or reinstate a user directly, without a report
+func SuspendUserHandler(db *sql.DB, suspended bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// The moderator is placed in the context by auth.AuthMiddleware
+		moderatorID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var request struct {
+			UserID string `json:"user_id"`
+			Note   string `json:"note,omitempty"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if request.UserID == "" {
+			http.Error(w, "Missing user_id", http.StatusBadRequest)
+			return
+		}
+		if request.UserID == moderatorID {
+			http.Error(w, "You cannot change your own suspension", http.StatusBadRequest)
+			return
+		}
+		if !requireOutranks(db, w, r, request.UserID) {
+			return
+		}
+
+		// The change and its audit entry are recorded together
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Failed to update suspension", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		err = SetUserSuspended(tx, request.UserID, suspended)
+		if err == ErrContentNotFound {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to update suspension", http.StatusInternalServerError)
+			return
+		}
+
+		action := "unsuspend_user"
+		if suspended {
+			action = "suspend_user"
+		}
+		if err := LogAction(tx, moderatorID, action, "user", request.UserID, request.UserID, "", request.Note); err != nil {
+			http.Error(w, "Failed to record moderation action", http.StatusInternalServerError)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to update suspension", http.StatusInternalServerError)
+			return
+		}
+
+		if suspended {
+			w.Write([]byte("User suspended successfully"))
+		} else {
+			w.Write([]byte("User reinstated successfully"))
+		}
+	}
+}
+
+// GetModerationActionsHandler returns the audit trail, optionally filtered by content or target user
+func GetModerationActionsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		contentType := r.URL.Query().Get("content_type")
+		contentID := r.URL.Query().Get("content_id")
+		targetUserID := r.URL.Query().Get("user_id")
+
+		rows, err := db.Query(`
+			SELECT a.id, COALESCE(a.moderator_id, ''), COALESCE(u.nickname, ''), a.action, COALESCE(a.content_type, ''), COALESCE(a.content_id, ''),
+			       COALESCE(a.target_user_id, ''), COALESCE(a.report_id, ''), COALESCE(a.note, ''), a.created_at
+			FROM moderation_actions a
+			LEFT JOIN users u ON u.id = a.moderator_id
+			WHERE (? = '' OR a.content_type = ?)
+			  AND (? = '' OR a.content_id = ?)
+			  AND (? = '' OR a.target_user_id = ?)
+			ORDER BY a.created_at DESC
+		`, contentType, contentType, contentID, contentID, targetUserID, targetUserID)
+		if err != nil {
+			http.Error(w, "Failed to fetch moderation actions", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		var actions []Action
+		for rows.Next() {
+			var action Action
+			if err := rows.Scan(
+				&action.ID, &action.ModeratorID, &action.ModeratorNickname, &action.Action, &action.ContentType,
+				&action.ContentID, &action.TargetUserID, &action.ReportID, &action.Note, &action.CreatedAt,
+			); err != nil {
+				http.Error(w, "Failed to parse moderation actions", http.StatusInternalServerError)
+				return
+			}
+			actions = append(actions, action)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(actions)
+	}
+}
@@ -0,0 +1,141 @@
+package moderation
+
+import (
+	"database/sql"
+	"errors"
+	"social-network/app/sessions"
+
+	"github.com/google/uuid"
+)
+
+// contentTable describes where a reportable content type is stored
+type contentTable struct {
+	Table       string
+	OwnerColumn string
+}
+
+// contentTables maps each reportable content type to its table
+var contentTables = map[string]contentTable{
+	"post":                 {Table: "posts", OwnerColumn: "user_id"},
+	"comment":              {Table: "comments", OwnerColumn: "user_id"},
+	"group_post":           {Table: "group_posts", OwnerColumn: "user_id"},
+	"group_post_comment":   {Table: "group_post_comments", OwnerColumn: "user_id"},
+	"group_chat_message":   {Table: "group_chat_messages", OwnerColumn: "sender_id"},
+	"private_chat_message": {Table: "private_chat_messages", OwnerColumn: "sender_id"},
+}
+
+// reportReasons lists the accepted report categories
+var reportReasons = []string{"spam", "harassment", "hate_speech", "violence", "nudity", "misinformation", "impersonation", "other"}
+
+var (
+	ErrUnknownContentType = errors.New("unknown content type")
+	ErrContentNotFound    = errors.New("content not found")
+)
+
+// Execer runs statements on a *sql.DB or inside a *sql.Tx, so a moderation change and its audit
+// entry can be written in the same transaction
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// ContentOwner returns the author of a piece of content, or the user itself for "user" reports
+func ContentOwner(db *sql.DB, contentType, contentID string) (string, error) {
+	if contentType == "user" {
+		var exists bool
+		if err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)`, contentID).Scan(&exists); err != nil {
+			return "", err
+		}
+		if !exists {
+			return "", ErrContentNotFound
+		}
+		return contentID, nil
+	}
+
+	table, ok := contentTables[contentType]
+	if !ok {
+		return "", ErrUnknownContentType
+	}
+
+	var ownerID string
+	err := db.QueryRow(`SELECT `+table.OwnerColumn+` FROM `+table.Table+` WHERE id = ?`, contentID).Scan(&ownerID)
+	if err == sql.ErrNoRows {
+		return "", ErrContentNotFound
+	}
+	return ownerID, err
+}
+
+// SetContentHidden hides or restores a piece of content
+func SetContentHidden(db Execer, contentType, contentID string, hidden bool) error {
+	table, ok := contentTables[contentType]
+	if !ok {
+		return ErrUnknownContentType
+	}
+
+	result, err := db.Exec(`UPDATE `+table.Table+` SET hidden = ? WHERE id = ?`, hidden, contentID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrContentNotFound
+	}
+	return nil
+}
+
+// roleRanks orders the global roles from least to most privileged
+var roleRanks = map[string]int{"user": 0, "moderator": 1, "admin": 2}
+
+// Outranks reports whether the staff member holds a higher role than the target user, which
+// moderation actions against a user require. It returns ErrContentNotFound for unknown users.
+func Outranks(db *sql.DB, staff sessions.User, targetUserID string) (bool, error) {
+	var targetRole string
+	err := db.QueryRow(`SELECT role FROM users WHERE id = ?`, targetUserID).Scan(&targetRole)
+	if err == sql.ErrNoRows {
+		return false, ErrContentNotFound
+	} else if err != nil {
+		return false, err
+	}
+	return roleRanks[staff.Role] > roleRanks[targetRole], nil
+}
+
+// SetUserSuspended suspends or reinstates a user. Suspending also ends all of the user's sessions.
+func SetUserSuspended(db Execer, userID string, suspended bool) error {
+	result, err := db.Exec(`UPDATE users SET suspended = ? WHERE id = ?`, suspended, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrContentNotFound
+	}
+
+	if suspended {
+		_, err = db.Exec(`DELETE FROM active_sessions WHERE user_id = ?`, userID)
+	}
+	return err
+}
+
+// LogAction records a moderation action in the audit trail
+func LogAction(db Execer, moderatorID, action, contentType, contentID, targetUserID, reportID, note string) error {
+	_, err := db.Exec(`
+		INSERT INTO moderation_actions (id, moderator_id, action, content_type, content_id, target_user_id, report_id, note)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, uuid.New().String(), moderatorID, action, contentType, contentID, targetUserID, reportID, note)
+	return err
+}
+
+// Helper function to check if a slice contains a string
+func contains(slice []string, item string) bool {
+	for _, s := range slice {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,332 @@
+package mutes
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"social-network/app/db/sqlite"
+	"social-network/app/sessions"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// MutedUser represents an account muted by the logged-in user
+type MutedUser struct {
+	ID       string `json:"id"`
+	Nickname string `json:"nickname"`
+	Avatar   string `json:"avatar"`
+	MutedAt  string `json:"muted_at"`
+}
+
+// MutedKeyword represents a keyword or phrase muted by the logged-in user
+type MutedKeyword struct {
+	ID        string `json:"id"`
+	Keyword   string `json:"keyword"`
+	CreatedAt string `json:"created_at"`
+}
+
+// MuteUserHandler hides another user's posts and comments without unfollowing them
+func MuteUserHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// The logged-in user ID from session
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var request struct {
+			MutedID string `json:"muted_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if request.MutedID == "" {
+			http.Error(w, "Missing muted_id", http.StatusBadRequest)
+			return
+		}
+		if userID == request.MutedID {
+			http.Error(w, "You cannot mute yourself", http.StatusBadRequest)
+			return
+		}
+
+		// Check if the muted user exists
+		var mutedExists bool
+		err = db.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)`, request.MutedID).Scan(&mutedExists)
+		if err != nil || !mutedExists {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		result, err := db.Exec(`
+			INSERT INTO muted_users (id, user_id, muted_user_id) VALUES (?, ?, ?)
+			ON CONFLICT(user_id, muted_user_id) DO NOTHING
+		`, uuid.New().String(), userID, request.MutedID)
+		if err != nil {
+			log.Printf("Error inserting mute: %v", err)
+			http.Error(w, "Failed to mute user", http.StatusInternalServerError)
+			return
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			http.Error(w, "Failed to determine affected rows", http.StatusInternalServerError)
+			return
+		}
+		if rowsAffected == 0 {
+			http.Error(w, "User already muted", http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("User muted successfully"))
+	}
+}
+
+// UnmuteUserHandler removes a mute created by the logged-in user
+func UnmuteUserHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// The logged-in user ID from session
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var request struct {
+			MutedID string `json:"muted_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if request.MutedID == "" {
+			http.Error(w, "Missing muted_id", http.StatusBadRequest)
+			return
+		}
+
+		result, err := db.Exec(`DELETE FROM muted_users WHERE user_id = ? AND muted_user_id = ?`, userID, request.MutedID)
+		if err != nil {
+			http.Error(w, "Failed to unmute user", http.StatusInternalServerError)
+			return
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			http.Error(w, "Failed to determine affected rows", http.StatusInternalServerError)
+			return
+		}
+		if rowsAffected == 0 {
+			http.Error(w, "You have not muted this user", http.StatusBadRequest)
+			return
+		}
+
+		w.Write([]byte("User unmuted successfully"))
+	}
+}
+
+// GetMutedUsersHandler fetches the accounts muted by the logged-in user
+func GetMutedUsersHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Get the logged-in user ID from the session
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		rows, err := db.Query(`
+			SELECT users.id, users.nickname, users.avatar, muted_users.created_at
+			FROM muted_users
+			JOIN users ON muted_users.muted_user_id = users.id
+			WHERE muted_users.user_id = ?
+			ORDER BY muted_users.created_at DESC
+		`, userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch muted users", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		muted := []MutedUser{}
+		for rows.Next() {
+			var user MutedUser
+			if err := rows.Scan(&user.ID, &user.Nickname, &user.Avatar, &user.MutedAt); err != nil {
+				http.Error(w, "Failed to parse muted users", http.StatusInternalServerError)
+				return
+			}
+			muted = append(muted, user)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(muted)
+	}
+}
+
+// AddMutedKeywordHandler mutes a keyword or phrase for the logged-in user
+func AddMutedKeywordHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// The logged-in user ID from session
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var request struct {
+			Keyword string `json:"keyword"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		// Keywords are matched case-insensitively, so store them folded like content is in fold_case()
+		keyword := sqlite.FoldCase(strings.TrimSpace(request.Keyword))
+		if keyword == "" {
+			http.Error(w, "Keyword cannot be empty", http.StatusBadRequest)
+			return
+		}
+		if len(keyword) > 100 {
+			http.Error(w, "Keyword cannot exceed 100 characters", http.StatusBadRequest)
+			return
+		}
+
+		keywordID := uuid.New().String()
+		result, err := db.Exec(`
+			INSERT INTO muted_keywords (id, user_id, keyword) VALUES (?, ?, ?)
+			ON CONFLICT(user_id, keyword) DO NOTHING
+		`, keywordID, userID, keyword)
+		if err != nil {
+			log.Printf("Error inserting muted keyword: %v", err)
+			http.Error(w, "Failed to mute keyword", http.StatusInternalServerError)
+			return
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			http.Error(w, "Failed to determine affected rows", http.StatusInternalServerError)
+			return
+		}
+		if rowsAffected == 0 {
+			http.Error(w, "Keyword already muted", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Keyword muted successfully",
+			"id":      keywordID,
+			"keyword": keyword,
+		})
+	}
+}
+
+// RemoveMutedKeywordHandler unmutes one of the logged-in user's keywords
+func RemoveMutedKeywordHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// The logged-in user ID from session
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		// Extract keyword ID from query
+		keywordID := r.URL.Query().Get("id")
+		if keywordID == "" {
+			http.Error(w, "Missing keyword ID", http.StatusBadRequest)
+			return
+		}
+
+		result, err := db.Exec(`DELETE FROM muted_keywords WHERE id = ? AND user_id = ?`, keywordID, userID)
+		if err != nil {
+			http.Error(w, "Failed to unmute keyword", http.StatusInternalServerError)
+			return
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			http.Error(w, "Failed to determine affected rows", http.StatusInternalServerError)
+			return
+		}
+		if rowsAffected == 0 {
+			http.Error(w, "Muted keyword not found", http.StatusNotFound)
+			return
+		}
+
+		w.Write([]byte("Keyword unmuted successfully"))
+	}
+}
+
+// GetMutedKeywordsHandler fetches the keywords muted by the logged-in user
+func GetMutedKeywordsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Get the logged-in user ID from the session
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		rows, err := db.Query(`
+			SELECT id, keyword, created_at FROM muted_keywords
+			WHERE user_id = ?
+			ORDER BY created_at DESC
+		`, userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch muted keywords", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		keywords := []MutedKeyword{}
+		for rows.Next() {
+			var keyword MutedKeyword
+			if err := rows.Scan(&keyword.ID, &keyword.Keyword, &keyword.CreatedAt); err != nil {
+				http.Error(w, "Failed to parse muted keywords", http.StatusInternalServerError)
+				return
+			}
+			keywords = append(keywords, keyword)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(keywords)
+	}
+}
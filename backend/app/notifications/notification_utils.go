@@ -11,7 +11,7 @@ func CreateNotification(db *sql.DB, userID, notificationType, content, postID, r
 	notificationID := uuid.New().String()
 	_, err := db.Exec(`
 		INSERT INTO notifications (id, user_id, type, content, post_id, related_user_id, group_id, event_id)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		VALUES (?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''))
 	`, notificationID, userID, notificationType, content, postID, relatedUserID, groupID, eventID)
 	if err != nil {
 		return err
@@ -8,6 +8,9 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"social-network/app/audiences"
+	"social-network/app/hashtags"
+	"social-network/app/mentions"
 	"social-network/app/sessions"
 	"strings"
 
@@ -21,12 +24,14 @@ type Post struct {
 	ImageURL      string   `json:"image_url,omitempty"`
 	Privacy       string   `json:"privacy"`
 	AllowedUsers  []string `json:"allowed_users,omitempty"`
+	AudienceIDs   []string `json:"audience_ids,omitempty"`
 	LikesCount    int      `json:"likes_count"`
 	CommentsCount int      `json:"comments_count"`
 	CreatedAt     string   `json:"created_at"`
 	Nickname      string   `json:"nickname"`
 	Avatar        string   `json:"avatar"`
 	HasLiked      bool     `json:"has_liked"` // New field
+	Entities      []mentions.Entity `json:"entities,omitempty"`
 }
 
 
@@ -47,7 +52,7 @@ func CreatePostHandler(db *sql.DB) http.HandlerFunc {
         }
 
         // Retrieve user ID from session
-        userID, err := sessions.GetUserIDFromSession(r)
+        userID, err := sessions.UserIDFromContext(r.Context())
         if err != nil {
             http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
             return
@@ -73,6 +78,21 @@ func CreatePostHandler(db *sql.DB) http.HandlerFunc {
             return
         }
 
+        // Private posts may also be shared with the user's saved audience lists
+        var audienceIDs []string
+        if privacy == "private" {
+            audienceIDs = unique(r.Form["audience_ids[]"])
+            owns, err := audiences.OwnsAudiences(db, userID, audienceIDs)
+            if err != nil {
+                http.Error(w, "Failed to check audiences", http.StatusInternalServerError)
+                return
+            }
+            if !owns {
+                http.Error(w, "Invalid audience: you can only share with your own audiences", http.StatusBadRequest)
+                return
+            }
+        }
+
         // Ensure the "uploads" directory exists
         uploadDir := "uploads"
         if _, err := os.Stat(uploadDir); os.IsNotExist(err) {
@@ -118,12 +138,20 @@ func CreatePostHandler(db *sql.DB) http.HandlerFunc {
         // Generate a UUID for the post
         postID := uuid.New().String()
 
+        // Insert the post and who it is shared with in one transaction, so a failure leaves no partial post
+        tx, err := db.Begin()
+        if err != nil {
+            http.Error(w, "Failed to create post", http.StatusInternalServerError)
+            return
+        }
+        defer tx.Rollback()
+
         // Insert post into the database (with created_at timestamp)
         query := `
             INSERT INTO posts (id, user_id, content, image_url, privacy, created_at)
             VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
         `
-        _, err = db.Exec(query, postID, userID, content, imageURL, privacy)
+        _, err = tx.Exec(query, postID, userID, content, imageURL, privacy)
         if err != nil {
             http.Error(w, "Failed to create post", http.StatusInternalServerError)
             return
@@ -131,7 +159,7 @@ func CreatePostHandler(db *sql.DB) http.HandlerFunc {
 
         // Retrieve the created_at timestamp for the response
         var createdAt string
-        err = db.QueryRow(`SELECT created_at FROM posts WHERE id = ?`, postID).Scan(&createdAt)
+        err = tx.QueryRow(`SELECT created_at FROM posts WHERE id = ?`, postID).Scan(&createdAt)
         if err != nil {
             http.Error(w, "Failed to fetch post timestamp", http.StatusInternalServerError)
             return
@@ -139,14 +167,38 @@ func CreatePostHandler(db *sql.DB) http.HandlerFunc {
 
         // If privacy is private, handle allowed users
         if privacy == "private" {
-            allowedUsers := r.Form["allowed_users[]"]
+            allowedUsers := unique(r.Form["allowed_users[]"])
             for _, allowedUserID := range allowedUsers {
-                _, err := db.Exec("INSERT INTO post_privacy (post_id, user_id) VALUES (?, ?)", postID, allowedUserID)
+                _, err := tx.Exec("INSERT INTO post_privacy (post_id, user_id) VALUES (?, ?)", postID, allowedUserID)
                 if err != nil {
                     http.Error(w, "Failed to set allowed users", http.StatusInternalServerError)
                     return
                 }
             }
+            for _, audienceID := range audienceIDs {
+                _, err := tx.Exec("INSERT INTO post_audiences (post_id, audience_id) VALUES (?, ?)", postID, audienceID)
+                if err != nil {
+                    http.Error(w, "Failed to set post audiences", http.StatusInternalServerError)
+                    return
+                }
+            }
+        }
+
+        if err := tx.Commit(); err != nil {
+            http.Error(w, "Failed to create post", http.StatusInternalServerError)
+            return
+        }
+
+        // Link and notify the users mentioned in the post
+        entities, err := mentions.Process(db, mentions.Content{Type: "post", ID: postID, AuthorID: userID, PostID: postID}, content)
+        if err != nil {
+            log.Printf("Failed to process mentions for post %s: %v", postID, err)
+        }
+
+        // Index the hashtags used in the post
+        tags, err := hashtags.Save(db, "post", postID, content)
+        if err != nil {
+            log.Printf("Failed to index hashtags for post %s: %v", postID, err)
         }
 
         // Build the response
@@ -157,6 +209,11 @@ func CreatePostHandler(db *sql.DB) http.HandlerFunc {
             "privacy":    privacy,
             "image_url":  imageURL,
             "created_at": createdAt, // Include created_at to prevent frontend errors
+            "entities":   entities,
+            "hashtags":   tags,
+        }
+        if len(audienceIDs) > 0 {
+            response["audience_ids"] = audienceIDs
         }
 
         w.Header().Set("Content-Type", "application/json")
@@ -168,6 +225,22 @@ func CreatePostHandler(db *sql.DB) http.HandlerFunc {
 
 
 
+// LoadEntities attaches the stored mentions to each post
+func LoadEntities(db *sql.DB, posts []Post) error {
+	ids := make([]string, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+	found, err := mentions.Load(db, "post", ids)
+	if err != nil {
+		return err
+	}
+	for i := range posts {
+		posts[i].Entities = found[posts[i].ID]
+	}
+	return nil
+}
+
 // Helper function to check if a slice contains a string
 func contains(slice []string, item string) bool {
 	for _, s := range slice {
@@ -178,6 +251,19 @@ func contains(slice []string, item string) bool {
 	return false
 }
 
+// unique returns the distinct non-empty values of a slice, in order
+func unique(values []string) []string {
+    var result []string
+    seen := map[string]bool{}
+    for _, value := range values {
+        if value != "" && !seen[value] {
+            seen[value] = true
+            result = append(result, value)
+        }
+    }
+    return result
+}
+
 
 // GetPostsHandler fetches all posts based on privacy and includes if the user has liked each post
 func GetPostsHandler(db *sql.DB) http.HandlerFunc {
@@ -188,12 +274,15 @@ func GetPostsHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		// Retrieve the user_id from the session
-		userID, err := sessions.GetUserIDFromSession(r)
+		userID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
 			return
 		}
 
+		// Muted accounts and keywords are filtered out unless show_muted=true is passed
+		showMuted := r.URL.Query().Get("show_muted") == "true"
+
 		query := `
 SELECT 
 	posts.id, 
@@ -210,17 +299,36 @@ SELECT
 FROM posts
 INNER JOIN users ON posts.user_id = users.id
 WHERE
+	posts.hidden = 0
+	AND (
 	posts.privacy = 'public'
 	OR (posts.privacy = 'almost-private' AND (posts.user_id = ? OR EXISTS(
 	    SELECT 1 FROM followers WHERE follower_id = ? AND followed_id = posts.user_id AND status = 'accepted'
 	)))
 	OR (posts.privacy = 'private' AND (posts.user_id = ? OR EXISTS(
 	    SELECT 1 FROM post_privacy WHERE post_id = posts.id AND user_id = ?
+	) OR EXISTS(
+	    SELECT 1 FROM post_audiences
+	    JOIN audience_members ON audience_members.audience_id = post_audiences.audience_id
+	    WHERE post_audiences.post_id = posts.id AND audience_members.user_id = ?
 	)))
+	)
+	AND NOT EXISTS(
+	    SELECT 1 FROM blocks
+	    WHERE (blocker_id = posts.user_id AND blocked_id = ?)
+	       OR (blocker_id = ? AND blocked_id = posts.user_id)
+	)
+	AND (? OR (
+	    NOT EXISTS(SELECT 1 FROM muted_users WHERE user_id = ? AND muted_user_id = posts.user_id)
+	    AND (posts.user_id = ? OR NOT EXISTS(
+	        SELECT 1 FROM muted_keywords WHERE user_id = ? AND instr(fold_case(posts.content), keyword) > 0
+	    ))
+	))
 ORDER BY posts.created_at DESC;
 `
-		// Pass the userID 5 times as needed:
-		rows, err := db.Query(query, userID, userID, userID, userID, userID)
+		// Pass the userID 8 times as needed, then the mute filter arguments:
+		rows, err := db.Query(query, userID, userID, userID, userID, userID, userID, userID, userID,
+			showMuted, userID, userID, userID)
 		if err != nil {
 			http.Error(w, "Failed to fetch posts", http.StatusInternalServerError)
 			return
@@ -247,6 +355,11 @@ ORDER BY posts.created_at DESC;
 			posts = append(posts, post)
 		}
 
+		if err := LoadEntities(db, posts); err != nil {
+			http.Error(w, "Failed to fetch mentions", http.StatusInternalServerError)
+			return
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(posts)
 	}
@@ -265,7 +378,7 @@ func UpdatePostPrivacyHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		// Retrieve user ID from session
-		userID, err := sessions.GetUserIDFromSession(r)
+		userID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
 			return
@@ -276,6 +389,7 @@ func UpdatePostPrivacyHandler(db *sql.DB) http.HandlerFunc {
 			PostID       string   `json:"post_id"`
 			Privacy      string   `json:"privacy"`
 			AllowedUsers []string `json:"allowed_users,omitempty"` // Only for private posts
+			AudienceIDs  []string `json:"audience_ids,omitempty"`  // Only for private posts
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&updateRequest); err != nil {
@@ -300,8 +414,36 @@ func UpdatePostPrivacyHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		if updateRequest.Privacy != "public" && updateRequest.Privacy != "almost-private" && updateRequest.Privacy != "private" {
+			http.Error(w, "Invalid privacy setting", http.StatusBadRequest)
+			return
+		}
+
+		// The same user or audience listed twice would break the primary key
+		updateRequest.AllowedUsers = unique(updateRequest.AllowedUsers)
+		updateRequest.AudienceIDs = unique(updateRequest.AudienceIDs)
+
+		// Audiences can only be selected from the owner's own lists
+		owns, err := audiences.OwnsAudiences(db, userID, updateRequest.AudienceIDs)
+		if err != nil {
+			http.Error(w, "Failed to check audiences", http.StatusInternalServerError)
+			return
+		}
+		if !owns {
+			http.Error(w, "Invalid audience: you can only share with your own audiences", http.StatusBadRequest)
+			return
+		}
+
+		// The privacy and its permissions change together so a failure never leaves them half replaced
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Failed to update privacy", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
 		// Update the privacy in the database
-		_, err = db.Exec(`UPDATE posts SET privacy = ? WHERE id = ?`, updateRequest.Privacy, updateRequest.PostID)
+		_, err = tx.Exec(`UPDATE posts SET privacy = ? WHERE id = ?`, updateRequest.Privacy, updateRequest.PostID)
 		if err != nil {
 			http.Error(w, "Failed to update privacy", http.StatusInternalServerError)
 			return
@@ -310,7 +452,7 @@ func UpdatePostPrivacyHandler(db *sql.DB) http.HandlerFunc {
 		// Handle private posts: update allowed users in post_privacy
 		if updateRequest.Privacy == "private" {
 			// Clear existing allowed users
-			_, err := db.Exec(`DELETE FROM post_privacy WHERE post_id = ?`, updateRequest.PostID)
+			_, err := tx.Exec(`DELETE FROM post_privacy WHERE post_id = ?`, updateRequest.PostID)
 			if err != nil {
 				http.Error(w, "Failed to clear private post permissions", http.StatusInternalServerError)
 				return
@@ -318,12 +460,31 @@ func UpdatePostPrivacyHandler(db *sql.DB) http.HandlerFunc {
 
 			// Add new allowed users
 			for _, allowedUserID := range updateRequest.AllowedUsers {
-				_, err := db.Exec(`INSERT INTO post_privacy (post_id, user_id) VALUES (?, ?)`, updateRequest.PostID, allowedUserID)
+				_, err := tx.Exec(`INSERT INTO post_privacy (post_id, user_id) VALUES (?, ?)`, updateRequest.PostID, allowedUserID)
 				if err != nil {
 					http.Error(w, "Failed to update private post permissions", http.StatusInternalServerError)
 					return
 				}
 			}
+
+			// Replace the audience lists the post is shared with
+			_, err = tx.Exec(`DELETE FROM post_audiences WHERE post_id = ?`, updateRequest.PostID)
+			if err != nil {
+				http.Error(w, "Failed to clear post audiences", http.StatusInternalServerError)
+				return
+			}
+			for _, audienceID := range updateRequest.AudienceIDs {
+				_, err := tx.Exec(`INSERT INTO post_audiences (post_id, audience_id) VALUES (?, ?)`, updateRequest.PostID, audienceID)
+				if err != nil {
+					http.Error(w, "Failed to update post audiences", http.StatusInternalServerError)
+					return
+				}
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to update privacy", http.StatusInternalServerError)
+			return
 		}
 
 		w.Write([]byte("Post privacy updated successfully"))
@@ -347,7 +508,7 @@ func DeletePostHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		// Retrieve user ID from session
-		userID, err := sessions.GetUserIDFromSession(r)
+		userID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
 			return
@@ -370,18 +531,32 @@ func DeletePostHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Delete the post from the database
-		query := `DELETE FROM posts WHERE id = ?`
-		_, err = db.Exec(query, postID)
+		// Delete the post together with the rows that depend on it, including the mentions in its comments
+		queries := []string{
+			`DELETE FROM mentions WHERE (content_type = 'post' AND content_id = ?1)
+			    OR (content_type = 'comment' AND content_id IN (SELECT id FROM comments WHERE post_id = ?1))`,
+			`DELETE FROM hashtags WHERE content_type = 'post' AND content_id = ?`,
+			`DELETE FROM likes WHERE post_id = ?`,
+			`DELETE FROM comments WHERE post_id = ?`,
+			`DELETE FROM post_privacy WHERE post_id = ?`,
+			`DELETE FROM post_audiences WHERE post_id = ?`,
+			`DELETE FROM notifications WHERE post_id = ?`,
+			`DELETE FROM posts WHERE id = ?`,
+		}
+		tx, err := db.Begin()
 		if err != nil {
 			http.Error(w, "Failed to delete post", http.StatusInternalServerError)
 			return
 		}
-
-		// Clean up private permissions for the post
-		_, err = db.Exec(`DELETE FROM post_privacy WHERE post_id = ?`, postID)
-		if err != nil {
-			http.Error(w, "Failed to delete post privacy settings", http.StatusInternalServerError)
+		defer tx.Rollback()
+		for _, query := range queries {
+			if _, err := tx.Exec(query, postID); err != nil {
+				http.Error(w, "Failed to delete post", http.StatusInternalServerError)
+				return
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to delete post", http.StatusInternalServerError)
 			return
 		}
 
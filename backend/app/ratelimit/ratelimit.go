@@ -0,0 +1,119 @@
+package ratelimit
+
+import (
+	"math"
+	"net/http"
+	"social-network/app/sessions"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// idleBucketTTL is how long an untouched bucket is kept before it is evicted
+const idleBucketTTL = 10 * time.Minute
+
+// Limiter is a keyed token bucket: each key gets Burst tokens that refill at Rate per second
+type Limiter struct {
+	rate    float64
+	burst   float64
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter creates a limiter allowing rate events per second with bursts of up to burst events
+func NewLimiter(rate float64, burst int) *Limiter {
+	l := &Limiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+	}
+	go l.evictIdle()
+	return l
+}
+
+// PerMinute is a convenience for limits expressed as events per minute
+func PerMinute(events float64) float64 {
+	return events / 60
+}
+
+// Allow takes a token from the key's bucket. When the bucket is empty it returns false
+// and how long the caller should wait before the next token is available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	// Refill for the time elapsed since the last request
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// evictIdle periodically drops buckets that have not been used for a while
+func (l *Limiter) evictIdle() {
+	ticker := time.NewTicker(idleBucketTTL)
+	defer ticker.Stop()
+	for range ticker.C {
+		l.mu.Lock()
+		for key, b := range l.buckets {
+			if time.Since(b.last) > idleBucketTTL {
+				delete(l.buckets, key)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+// tooManyRequests writes a 429 response with a Retry-After header
+func tooManyRequests(w http.ResponseWriter, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, "Too many requests, please slow down", http.StatusTooManyRequests)
+}
+
+// PerIP applies a limit keyed by client IP, to a route or to the whole server
+func PerIP(l *Limiter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ok, wait := l.Allow(sessions.ClientIP(r)); !ok {
+			tooManyRequests(w, wait)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// PerUser applies a limit keyed by the user loaded by auth.AuthMiddleware, falling back to the client IP.
+// Mounted behind the middleware it reuses the user already resolved for the request.
+func PerUser(l *Limiter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := "ip:" + sessions.ClientIP(r)
+		if userID, err := sessions.UserIDFromContext(r.Context()); err == nil {
+			key = "user:" + userID
+		}
+		if ok, wait := l.Allow(key); !ok {
+			tooManyRequests(w, wait)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
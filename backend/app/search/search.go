@@ -4,14 +4,20 @@ import (
 	"database/sql"
 	"encoding/json"
 	"net/http"
+	"social-network/app/followers"
+	"social-network/app/sessions"
+	"social-network/app/users"
 	"strings"
 )
 
 // SearchUser holds basic user information for search results.
 type SearchUser struct {
-	ID       string `json:"id"`
-	Nickname string `json:"nickname"`
-	Avatar   string `json:"avatar"`
+	ID           string                 `json:"id"`
+	Nickname     string                 `json:"nickname"`
+	FirstName    string                 `json:"first_name,omitempty"`
+	LastName     string                 `json:"last_name,omitempty"`
+	Avatar       string                 `json:"avatar"`
+	Relationship followers.Relationship `json:"relationship"`
 }
 
 // SearchGroup holds basic group information for search results.
@@ -21,7 +27,8 @@ type SearchGroup struct {
 	Description string `json:"description"`
 }
 
-// SearchHandler searches for users (by nickname) and groups (by name).
+// SearchHandler searches for users (by nickname, or by full name where the viewer may see it) and
+// groups (by name).
 func SearchHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Only allow GET requests.
@@ -30,6 +37,13 @@ func SearchHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		// Retrieve the user ID from the session.
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
 		// Retrieve the search query from the URL query parameters.
 		// For example: /search?query=john
 		queryParam := r.URL.Query().Get("query")
@@ -41,22 +55,49 @@ func SearchHandler(db *sql.DB) http.HandlerFunc {
 		// Use wildcards for partial matching.
 		searchTerm := "%" + queryParam + "%"
 
-		// --- Search for users by nickname ---
-		userRows, err := db.Query(`SELECT id, nickname, avatar FROM users WHERE nickname LIKE ?`, searchTerm)
+		// --- Search for users by nickname or visible full name, hiding users blocked in either direction ---
+		userRows, err := db.Query(`
+			SELECT id, nickname, avatar, first_name, last_name, name_visibility, COALESCE(private, 0) FROM users
+			WHERE (
+				nickname LIKE ?1
+				OR ((first_name || ' ' || last_name) LIKE ?1 AND (
+					(name_visibility = 'public' AND COALESCE(private, 0) = 0)
+					OR users.id = ?2
+					OR (name_visibility IN ('public', 'followers') AND EXISTS(
+						SELECT 1 FROM followers WHERE follower_id = ?2 AND followed_id = users.id AND status = 'accepted'
+					))
+				))
+			)
+			AND NOT EXISTS(
+				SELECT 1 FROM blocks
+				WHERE (blocker_id = users.id AND blocked_id = ?2)
+				   OR (blocker_id = ?2 AND blocked_id = users.id)
+			)
+		`, searchTerm, userID)
 		if err != nil {
 			http.Error(w, "Failed to search users", http.StatusInternalServerError)
 			return
 		}
 		defer userRows.Close()
 
-		var users []SearchUser
+		var foundUsers []SearchUser
 		for userRows.Next() {
 			var user SearchUser
-			if err := userRows.Scan(&user.ID, &user.Nickname, &user.Avatar); err != nil {
+			var nameVisibility string
+			var private bool
+			if err := userRows.Scan(&user.ID, &user.Nickname, &user.Avatar, &user.FirstName, &user.LastName, &nameVisibility, &private); err != nil {
 				http.Error(w, "Failed to scan user", http.StatusInternalServerError)
 				return
 			}
-			users = append(users, user)
+			user.Relationship, err = followers.GetRelationship(db, userID, user.ID)
+			if err != nil {
+				http.Error(w, "Failed to fetch relationship", http.StatusInternalServerError)
+				return
+			}
+			if !users.CanViewField(users.EffectiveVisibility(nameVisibility, private), user.Relationship) {
+				user.FirstName, user.LastName = "", ""
+			}
+			foundUsers = append(foundUsers, user)
 		}
 
 		// --- Search for groups by name ---
@@ -79,7 +120,7 @@ func SearchHandler(db *sql.DB) http.HandlerFunc {
 
 		// Build the final response.
 		response := map[string]interface{}{
-			"users":  users,
+			"users":  foundUsers,
 			"groups": groups,
 		}
 
@@ -0,0 +1,121 @@
+package sessions
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Token scopes. Read covers GET requests, write every other method and chat the WebSocket endpoints.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeChat  = "chat"
+)
+
+// ValidScopes lists every scope a token can be granted
+var ValidScopes = []string{ScopeRead, ScopeWrite, ScopeChat}
+
+var (
+	// ErrInvalidToken is returned when a bearer token is unknown, revoked or expired
+	ErrInvalidToken = errors.New("invalid or expired token")
+	// ErrInsufficientScope is returned when a bearer token lacks the scope a request needs
+	ErrInsufficientScope = errors.New("token does not have the required scope")
+)
+
+// chatPaths are the WebSocket endpoints that need the chat scope
+var chatPaths = []string{"/chat/private", "/groups/chat", "/ws/"}
+
+// BearerToken returns the token from an "Authorization: Bearer" header, or "" if there is none
+func BearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+// RequiredScope returns the scope a bearer token needs for the request
+func RequiredScope(r *http.Request) string {
+	for _, path := range chatPaths {
+		if strings.HasPrefix(r.URL.Path, path) {
+			return ScopeChat
+		}
+	}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return ScopeRead
+	}
+	return ScopeWrite
+}
+
+// Authenticate resolves the user behind a request, from a bearer token when one is sent
+// and from the session cookie otherwise
+func Authenticate(db *sql.DB, r *http.Request) (string, error) {
+	if token := BearerToken(r); token != "" {
+		return LookupBearerToken(db, token, RequiredScope(r))
+	}
+
+	sessionID, err := GetSessionValue(r, SessionCookieName)
+	if err != nil {
+		return "", err
+	}
+	if sessionID == "" {
+		return "", ErrNoSession
+	}
+	return LookupSession(db, sessionID)
+}
+
+// LookupBearerToken resolves a personal or access token to its user and checks it grants the scope.
+// Refresh tokens are only accepted by the refresh endpoint. Tokens of suspended users are rejected.
+func LookupBearerToken(db *sql.DB, token, scope string) (string, error) {
+	var tokenID, userID, scopes string
+	err := db.QueryRow(`
+		SELECT api_tokens.id, api_tokens.user_id, api_tokens.scopes
+		FROM api_tokens
+		JOIN users ON users.id = api_tokens.user_id
+		WHERE api_tokens.token_hash = ? AND api_tokens.kind IN ('personal', 'access')
+		  AND (api_tokens.expires_at IS NULL OR api_tokens.expires_at > CURRENT_TIMESTAMP)
+		  AND users.suspended = 0
+	`, HashSessionID(token)).Scan(&tokenID, &userID, &scopes)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrInvalidToken
+		}
+		return "", err
+	}
+
+	if !HasScope(scopes, scope) {
+		return "", ErrInsufficientScope
+	}
+
+	// Throttled like TouchSession
+	db.Exec(`
+		UPDATE api_tokens SET last_used_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND (last_used_at IS NULL OR last_used_at < datetime('now', '-1 minute'))
+	`, tokenID)
+	return userID, nil
+}
+
+// HasScope reports whether a space-separated scope list contains the scope
+func HasScope(scopes, scope string) bool {
+	for _, s := range strings.Fields(scopes) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// RevokeTokenPairs deletes every access and refresh token of a user. Personal access tokens are kept.
+func RevokeTokenPairs(db *sql.DB, userID string) error {
+	_, err := db.Exec(`DELETE FROM api_tokens WHERE user_id = ? AND kind IN ('access', 'refresh')`, userID)
+	return err
+}
+
+// RevokeAllTokens deletes every token of a user, personal access tokens included, for when their
+// password may have been compromised
+func RevokeAllTokens(db *sql.DB, userID string) error {
+	_, err := db.Exec(`DELETE FROM api_tokens WHERE user_id = ?`, userID)
+	return err
+}
@@ -0,0 +1,34 @@
+package sessions
+
+import "context"
+
+// userContextKey is the context key auth.AuthMiddleware stores the logged-in user under.
+// It is unexported so no other package can read or overwrite the value by accident.
+type userContextKey struct{}
+
+// User is the logged-in user as loaded once per request by auth.AuthMiddleware
+type User struct {
+	ID      string
+	Role    string // "user", "moderator" or "admin"
+	Private bool   // Whether the user's profile is private
+}
+
+// WithUser returns a copy of ctx carrying the logged-in user
+func WithUser(ctx context.Context, user User) context.Context {
+	return context.WithValue(ctx, userContextKey{}, user)
+}
+
+// UserFromContext returns the logged-in user, or false when the request did not pass through auth.AuthMiddleware
+func UserFromContext(ctx context.Context) (User, bool) {
+	user, ok := ctx.Value(userContextKey{}).(User)
+	return user, ok && user.ID != ""
+}
+
+// UserIDFromContext returns the logged-in user's ID, or ErrNoSession when the request is not authenticated
+func UserIDFromContext(ctx context.Context) (string, error) {
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return "", ErrNoSession
+	}
+	return user.ID, nil
+}
@@ -0,0 +1,34 @@
+package sessions
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+)
+
+const (
+	// CSRFCookieName holds the CSRF token. It is readable by JavaScript so the frontend can echo it back.
+	CSRFCookieName = "csrf_token"
+	// CSRFHeaderName is the header state-changing requests must repeat the token in
+	CSRFHeaderName = "X-CSRF-Token"
+)
+
+// CSRFToken derives the CSRF token for a raw session token. Deriving it keeps it bound to the
+// session without storing it, and a planted csrf_token cookie cannot match someone else's session.
+func CSRFToken(sessionToken string) string {
+	sum := sha256.Sum256([]byte("csrf:" + sessionToken))
+	return hex.EncodeToString(sum[:])
+}
+
+// SetCSRFCookie sets the CSRF cookie for a session. maxAge follows the session cookie.
+func SetCSRFCookie(w http.ResponseWriter, sessionToken string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRFCookieName,
+		Value:    CSRFToken(sessionToken),
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: false,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
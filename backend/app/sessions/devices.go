@@ -0,0 +1,130 @@
+package sessions
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+)
+
+// Session represents one of the user's signed-in devices
+type Session struct {
+	ID         string `json:"id"`
+	UserAgent  string `json:"user_agent"`
+	IPAddress  string `json:"ip_address"`
+	CreatedAt  string `json:"created_at"`
+	LastUsedAt string `json:"last_used_at"`
+	ExpiresAt  string `json:"expires_at"`
+	Current    bool   `json:"current"`
+}
+
+// GetSessionsHandler lists the logged-in user's active sessions, marking the one making the request
+func GetSessionsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+		currentSessionID := CurrentSessionID(r)
+
+		rows, err := db.Query(`
+			SELECT public_id, COALESCE(user_agent, ''), COALESCE(ip_address, ''), created_at,
+			       COALESCE(last_used_at, created_at), expires_at, session_id = ?
+			FROM active_sessions
+			WHERE user_id = ? AND expires_at > CURRENT_TIMESTAMP
+			ORDER BY COALESCE(last_used_at, created_at) DESC
+		`, currentSessionID, userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch sessions", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		var sessions []Session
+		for rows.Next() {
+			var session Session
+			if err := rows.Scan(&session.ID, &session.UserAgent, &session.IPAddress, &session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt, &session.Current); err != nil {
+				http.Error(w, "Failed to parse sessions", http.StatusInternalServerError)
+				return
+			}
+			sessions = append(sessions, session)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sessions)
+	}
+}
+
+// RevokeSessionHandler signs out one of the logged-in user's sessions by its public ID
+func RevokeSessionHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		sessionID := r.URL.Query().Get("id")
+		if sessionID == "" {
+			http.Error(w, "Missing session ID", http.StatusBadRequest)
+			return
+		}
+
+		result, err := db.Exec(`DELETE FROM active_sessions WHERE public_id = ? AND user_id = ?`, sessionID, userID)
+		if err != nil {
+			http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+			return
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			http.Error(w, "Failed to determine affected rows", http.StatusInternalServerError)
+			return
+		}
+		if rowsAffected == 0 {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+
+		w.Write([]byte("Session revoked successfully"))
+	}
+}
+
+// RevokeOtherSessionsHandler signs the logged-in user out everywhere except the current device
+func RevokeOtherSessionsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+		currentSessionID := CurrentSessionID(r)
+
+		revoked, err := RevokeUserSessions(db, userID, currentSessionID)
+		if err != nil {
+			http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Other sessions revoked successfully",
+			"revoked": revoked,
+		})
+	}
+}
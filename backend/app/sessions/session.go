@@ -48,30 +48,8 @@ func DestroySession(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
-// GetUserIDFromSession retrieves the user_id from the session cookie
+// GetUserIDFromSession retrieves the user_id from the session cookie, or from an
+// "Authorization: Bearer" token when the request carries one
 func GetUserIDFromSession(r *http.Request) (string, error) {
-	// Retrieve the session_id from the session cookie
-	sessionID, err := GetSessionValue(r, SessionCookieName)
-	if err != nil {
-		return "", err
-	}
-
-	// If session_id is empty, return an error
-	if sessionID == "" {
-		return "", errors.New("session_id not found in session cookie")
-	}
-
-	// Query the database to retrieve the user_id associated with the session_id
-	var userID string
-	query := "SELECT user_id FROM active_sessions WHERE session_id = ? AND expires_at > CURRENT_TIMESTAMP"
-	err = DB.QueryRow(query, sessionID).Scan(&userID)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return "", errors.New("invalid or expired session")
-		}
-		return "", err
-	}
-
-	// Return the user_id
-	return userID, nil
-}
\ No newline at end of file
+	return Authenticate(DB, r)
+}
@@ -0,0 +1,243 @@
+package sessions
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// SessionTTL is how long a regular session stays valid without being used
+	SessionTTL = 24 * time.Hour
+	// RememberMeTTL is how long a "remember me" session stays valid without being used
+	RememberMeTTL = 30 * 24 * time.Hour
+	// rememberMeCookieAge keeps the browser cookie around; the server enforces the real expiry
+	rememberMeCookieAge = 365 * 24 * time.Hour
+)
+
+var (
+	// ErrNoSession is returned when the request carries no session cookie
+	ErrNoSession = errors.New("session_id not found in session cookie")
+	// ErrInvalidSession is returned when a session token is unknown or has expired
+	ErrInvalidSession = errors.New("invalid or expired session")
+)
+
+// HashSessionID returns the value stored in active_sessions for a session token.
+// Only the hash is persisted so a leaked database cannot be used to hijack sessions.
+func HashSessionID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CurrentSessionID returns the hashed ID of the session making the request, or "" if there is none
+func CurrentSessionID(r *http.Request) string {
+	token, err := GetSessionValue(r, SessionCookieName)
+	if err != nil || token == "" {
+		return ""
+	}
+	return HashSessionID(token)
+}
+
+// CreateSession stores a new session for the user and returns the raw token to hand to the client
+func CreateSession(db *sql.DB, r *http.Request, userID string, rememberMe bool) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	ttl := SessionTTL
+	if rememberMe {
+		ttl = RememberMeTTL
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO active_sessions (session_id, user_id, expires_at, public_id, user_agent, ip_address, last_used_at, remember_me)
+		VALUES (?, ?, datetime('now', ?), ?, ?, ?, CURRENT_TIMESTAMP, ?)
+	`, HashSessionID(token), userID, ttlModifier(ttl), uuid.New().String(), r.UserAgent(), ClientIP(r), rememberMe)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// SetSessionCookies sends the session, user_id and CSRF cookies. Regular sessions use browser-session
+// cookies while "remember me" sessions persist across browser restarts.
+func SetSessionCookies(w http.ResponseWriter, token, userID string, rememberMe bool) {
+	var maxAge int
+	if rememberMe {
+		maxAge = int(rememberMeCookieAge.Seconds())
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   true,                    // Ensure secure transport
+		SameSite: http.SameSiteStrictMode, // Prevent CSRF attacks
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     "user_id",
+		Value:    userID,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: false,
+		Secure:   true, // Ensure it's only sent over HTTPS
+		SameSite: http.SameSiteStrictMode,
+	})
+	SetCSRFCookie(w, token, maxAge)
+}
+
+// LookupSession resolves a raw session token to its user and renews the session's sliding expiry
+func LookupSession(db *sql.DB, token string) (string, error) {
+	sessionID := HashSessionID(token)
+
+	var userID string
+	err := db.QueryRow(`SELECT user_id FROM active_sessions WHERE session_id = ? AND expires_at > CURRENT_TIMESTAMP`, sessionID).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrInvalidSession
+		}
+		return "", err
+	}
+
+	// Record the activity for the user's device list and push the expiry forward
+	if err := TouchSession(db, sessionID); err != nil {
+		log.Printf("Error renewing session: %v", err)
+	}
+	return userID, nil
+}
+
+// TouchSession records that a session was just used and renews its expiry window.
+// Writes are throttled to once a minute per session.
+func TouchSession(db *sql.DB, sessionID string) error {
+	_, err := db.Exec(`
+		UPDATE active_sessions
+		SET last_used_at = CURRENT_TIMESTAMP,
+		    expires_at = CASE WHEN remember_me THEN datetime('now', ?) ELSE datetime('now', ?) END
+		WHERE session_id = ? AND (last_used_at IS NULL OR last_used_at < datetime('now', '-1 minute'))
+	`, ttlModifier(RememberMeTTL), ttlModifier(SessionTTL), sessionID)
+	return err
+}
+
+// trustedProxies are the reverse proxies allowed to report the client address in X-Forwarded-For,
+// listed as IPs or CIDR ranges, comma-separated, in the TRUSTED_PROXIES environment variable
+var trustedProxies = parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+
+// parseTrustedProxies parses a comma-separated list of IPs and CIDR ranges, skipping invalid entries
+func parseTrustedProxies(list string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			log.Printf("Ignoring invalid trusted proxy %q: %v", entry, err)
+			continue
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// isTrustedProxy reports whether addr belongs to one of the trusted proxies
+func isTrustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client that sent the request. X-Forwarded-For is only
+// honoured when the request comes from a trusted proxy, and then the right-most address that is
+// not a trusted proxy is used, since anything left of it could have been made up by the client.
+func ClientIP(r *http.Request) string {
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+	if !isTrustedProxy(peer) {
+		return peer
+	}
+
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !isTrustedProxy(hop) {
+			return hop
+		}
+		peer = hop
+	}
+	return peer
+}
+
+// RevokeUserSessions ends every session of a user except the given one (pass "" to end them all)
+func RevokeUserSessions(db *sql.DB, userID, exceptSessionID string) (int64, error) {
+	result, err := db.Exec(`DELETE FROM active_sessions WHERE user_id = ? AND session_id != ?`, userID, exceptSessionID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// PurgeExpiredSessions deletes every session whose expiry has passed
+func PurgeExpiredSessions(db *sql.DB) (int64, error) {
+	result, err := db.Exec(`DELETE FROM active_sessions WHERE expires_at <= CURRENT_TIMESTAMP`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// StartSessionReaper purges expired sessions in the background at the given interval
+func StartSessionReaper(db *sql.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if purged, err := PurgeExpiredSessions(db); err != nil {
+				log.Printf("Error purging expired sessions: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d expired sessions", purged)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// ttlModifier formats a duration as an SQLite datetime modifier
+func ttlModifier(ttl time.Duration) string {
+	return fmt.Sprintf("+%d seconds", int64(ttl.Seconds()))
+}
@@ -0,0 +1,107 @@
+package users
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"social-network/app/notifications"
+	"time"
+)
+
+// birthdayRemindersQuery finds followers to remind of a birthday on one of the given month-days
+// (?1, ?2). Only birthdays their owner shows to followers or everyone count, and a follower is
+// reminded at most once per birthday.
+const birthdayRemindersQuery = `
+	SELECT f.follower_id, u.id,
+	       COALESCE(NULLIF(u.nickname, ''), CASE WHEN u.name_visibility != 'only_me' THEN u.first_name END, 'Someone you follow')
+	FROM users u
+	JOIN followers f ON f.followed_id = u.id AND f.status = 'accepted'
+	JOIN users follower ON follower.id = f.follower_id
+	WHERE strftime('%m-%d', u.date_of_birth) IN (?1, ?2)
+	  AND u.birthday_visibility IN ('public', 'followers')
+	  AND COALESCE(u.suspended, 0) = 0
+	  AND COALESCE(follower.suspended, 0) = 0
+	  AND NOT EXISTS (
+		SELECT 1 FROM blocks
+		WHERE (blocker_id = u.id AND blocked_id = f.follower_id)
+		   OR (blocker_id = f.follower_id AND blocked_id = u.id)
+	  )
+	  AND NOT EXISTS (
+		SELECT 1 FROM notifications n
+		WHERE n.user_id = f.follower_id AND n.related_user_id = u.id AND n.type = 'birthday_reminder'
+		  AND n.created_at > datetime('now', '-7 days')
+	  )
+`
+
+// birthdayMonthDays returns the month-days (MM-DD) of the birthdays celebrated on day. Outside leap
+// years, birthdays on 29 February are celebrated on 28 February.
+func birthdayMonthDays(day time.Time) (string, string) {
+	monthDay := day.Format("01-02")
+	if monthDay == "02-28" && day.AddDate(0, 0, 1).Month() == time.March {
+		return monthDay, "02-29"
+	}
+	return monthDay, monthDay
+}
+
+// SendBirthdayReminders notifies followers of the birthdays coming up the day after now and returns
+// how many reminders were sent
+func SendBirthdayReminders(db *sql.DB, now time.Time) (int, error) {
+	first, second := birthdayMonthDays(now.AddDate(0, 0, 1))
+	rows, err := db.Query(birthdayRemindersQuery, first, second)
+	if err != nil {
+		return 0, err
+	}
+
+	type reminder struct {
+		followerID, userID, name string
+	}
+	var reminders []reminder
+	for rows.Next() {
+		var r reminder
+		if err := rows.Scan(&r.followerID, &r.userID, &r.name); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		reminders = append(reminders, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, r := range reminders {
+		err := notifications.CreateNotification(
+			db,
+			r.followerID,
+			"birthday_reminder",
+			fmt.Sprintf("It's %s's birthday tomorrow.", r.name),
+			"",       // postID
+			r.userID, // relatedUserID: whose birthday it is
+			"",       // groupID
+			"",
+		)
+		if err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// StartBirthdayReminders sends birthday reminders in the background at the given interval. Checking
+// more often than daily is harmless, since each follower is reminded only once per birthday.
+func StartBirthdayReminders(db *sql.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if sent, err := SendBirthdayReminders(db, time.Now().UTC()); err != nil {
+				log.Printf("Error sending birthday reminders: %v", err)
+			} else if sent > 0 {
+				log.Printf("Sent %d birthday reminders", sent)
+			}
+			<-ticker.C
+		}
+	}()
+}
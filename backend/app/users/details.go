@@ -0,0 +1,223 @@
+package users
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"social-network/app/auth"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// maxProfileLinks is how many website links a profile can list
+const maxProfileLinks = 5
+
+var (
+	errInvalidCoverType = errors.New("invalid cover image file type")
+	errPinnedNotOwnPost = errors.New("only one of your own posts can be pinned")
+)
+
+// ProfileLink is a website shown on a profile
+type ProfileLink struct {
+	Label string `json:"label,omitempty"`
+	URL   string `json:"url"`
+}
+
+// profileDetails are the optional profile fields beyond the basics. A nil field is left unchanged
+// by an update; an empty value clears it.
+type profileDetails struct {
+	Location     *string        `json:"location,omitempty"`
+	Pronouns     *string        `json:"pronouns,omitempty"`
+	Links        *[]ProfileLink `json:"links,omitempty"`
+	PinnedPostID *string        `json:"pinned_post_id,omitempty"`
+}
+
+// readForm fills the details present in a multipart form. Links are sent as a JSON array.
+func (d *profileDetails) readForm(form *multipart.Form) error {
+	value := func(key string) *string {
+		if values, ok := form.Value[key]; ok && len(values) > 0 {
+			v := values[0]
+			return &v
+		}
+		return nil
+	}
+
+	d.Location = value("location")
+	d.Pronouns = value("pronouns")
+	d.PinnedPostID = value("pinned_post_id")
+	if links := value("links"); links != nil {
+		var parsed []ProfileLink
+		if strings.TrimSpace(*links) != "" {
+			if err := json.Unmarshal([]byte(*links), &parsed); err != nil {
+				return errors.New("links must be a JSON array of {label, url} objects")
+			}
+		}
+		d.Links = &parsed
+	}
+	return nil
+}
+
+// validate checks and normalises the details being changed
+func (d *profileDetails) validate() error {
+	if d.Location != nil {
+		*d.Location = strings.TrimSpace(*d.Location)
+		if err := auth.ValidateLocation(*d.Location); err != nil {
+			return err
+		}
+	}
+	if d.Pronouns != nil {
+		*d.Pronouns = strings.TrimSpace(*d.Pronouns)
+		if *d.Pronouns != "" {
+			if err := auth.ValidatePronouns(*d.Pronouns); err != nil {
+				return err
+			}
+		}
+	}
+	if d.Links != nil {
+		if len(*d.Links) > maxProfileLinks {
+			return errors.New("a profile can list at most 5 links")
+		}
+		for i, link := range *d.Links {
+			link.Label = strings.TrimSpace(link.Label)
+			link.URL = strings.TrimSpace(link.URL)
+			if err := auth.ValidateLink(link.URL); err != nil {
+				return err
+			}
+			if err := auth.ValidateLinkLabel(link.Label); err != nil {
+				return err
+			}
+			(*d.Links)[i] = link
+		}
+	}
+	return nil
+}
+
+// save stores the details being changed. Links replace the whole list, and the pinned post must be
+// one of the user's own visible posts (errPinnedNotOwnPost otherwise).
+func (d *profileDetails) save(tx *sql.Tx, userID string) error {
+	nullable := func(v *string) interface{} {
+		if *v == "" {
+			return nil
+		}
+		return *v
+	}
+
+	if d.Location != nil {
+		if _, err := tx.Exec(`UPDATE users SET location = ? WHERE id = ?`, nullable(d.Location), userID); err != nil {
+			return err
+		}
+	}
+	if d.Pronouns != nil {
+		if _, err := tx.Exec(`UPDATE users SET pronouns = ? WHERE id = ?`, nullable(d.Pronouns), userID); err != nil {
+			return err
+		}
+	}
+	if d.PinnedPostID != nil {
+		if *d.PinnedPostID != "" {
+			var owned bool
+			err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM posts WHERE id = ? AND user_id = ? AND hidden = 0)`,
+				*d.PinnedPostID, userID).Scan(&owned)
+			if err != nil {
+				return err
+			}
+			if !owned {
+				return errPinnedNotOwnPost
+			}
+		}
+		if _, err := tx.Exec(`UPDATE users SET pinned_post_id = ? WHERE id = ?`, nullable(d.PinnedPostID), userID); err != nil {
+			return err
+		}
+	}
+	if d.Links != nil {
+		if _, err := tx.Exec(`DELETE FROM profile_links WHERE user_id = ?`, userID); err != nil {
+			return err
+		}
+		for i, link := range *d.Links {
+			_, err := tx.Exec(`INSERT INTO profile_links (id, user_id, label, url, position) VALUES (?, ?, ?, ?, ?)`,
+				uuid.New().String(), userID, link.Label, link.URL, i)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// getProfileLinks returns a user's links in display order
+func getProfileLinks(db *sql.DB, userID string) ([]ProfileLink, error) {
+	rows, err := db.Query(`SELECT COALESCE(label, ''), url FROM profile_links WHERE user_id = ? ORDER BY position`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []ProfileLink{}
+	for rows.Next() {
+		var link ProfileLink
+		if err := rows.Scan(&link.Label, &link.URL); err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+// saveCoverImage stores an uploaded cover image under uploads/ and returns its file name
+func saveCoverImage(file multipart.File, header *multipart.FileHeader) (string, error) {
+	allowedExtensions := []string{".jpg", ".jpeg", ".png", ".gif"}
+	fileExt := strings.ToLower(filepath.Ext(header.Filename))
+	valid := false
+	for _, ext := range allowedExtensions {
+		if fileExt == ext {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return "", errInvalidCoverType
+	}
+
+	uploadDir := "uploads"
+	if err := os.MkdirAll(uploadDir, 0755); err != nil {
+		return "", err
+	}
+	fileName := uuid.New().String() + fileExt
+	outFile, err := os.Create(filepath.Join(uploadDir, fileName))
+	if err != nil {
+		return "", err
+	}
+	defer outFile.Close()
+	if _, err := io.Copy(outFile, file); err != nil {
+		return "", err
+	}
+	return fileName, nil
+}
+
+// readCoverImage saves the cover_image file of a multipart profile update, if one was sent. It
+// writes the error response itself and reports whether the request can go on.
+func readCoverImage(w http.ResponseWriter, r *http.Request) (string, bool) {
+	file, header, err := r.FormFile("cover_image")
+	if err == http.ErrMissingFile {
+		return "", true
+	} else if err != nil {
+		http.Error(w, "Error processing cover image: "+err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	defer file.Close()
+
+	fileName, err := saveCoverImage(file, header)
+	if errors.Is(err, errInvalidCoverType) {
+		http.Error(w, "Invalid cover image file type", http.StatusBadRequest)
+		return "", false
+	} else if err != nil {
+		http.Error(w, "Failed to save cover image", http.StatusInternalServerError)
+		return "", false
+	}
+	return fileName, true
+}
@@ -0,0 +1,124 @@
+package users
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"social-network/app/sessions"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// NicknameGracePeriod is how long a nickname someone gave up still leads to their account and
+	// stays reserved for them
+	NicknameGracePeriod = 30 * 24 * time.Hour
+	// NicknameChangeCooldown is the minimum time between two nickname changes
+	NicknameChangeCooldown = 7 * 24 * time.Hour
+)
+
+// errNicknameCooldown is returned when the nickname was changed too recently
+var errNicknameCooldown = errors.New("nickname changed too recently")
+
+// ResolveNickname returns the account a nickname leads to: its current owner or, failing that, the
+// account that gave it up within the grace period (redirected is then true). It returns
+// sql.ErrNoRows when the nickname leads nowhere.
+func ResolveNickname(db *sql.DB, nickname string) (userID string, redirected bool, err error) {
+	err = db.QueryRow(`SELECT id FROM users WHERE nickname = ?`, nickname).Scan(&userID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return userID, false, err
+	}
+
+	err = db.QueryRow(`
+		SELECT user_id FROM nickname_history
+		WHERE nickname = ? AND reserved_until > CURRENT_TIMESTAMP
+		ORDER BY changed_at DESC LIMIT 1`, nickname).Scan(&userID)
+	return userID, err == nil, err
+}
+
+// changeNickname records that the user is switching from oldNickname to newNickname. The old
+// nickname keeps resolving to the user for the grace period, and taking back one of the user's own
+// old nicknames ends its redirect. It fails with errNicknameCooldown when the last change was too
+// recent, together with the time the next change is allowed.
+func changeNickname(tx *sql.Tx, userID, oldNickname, newNickname string) (string, error) {
+	var nextChange string
+	err := tx.QueryRow(`
+		SELECT COALESCE(MAX(datetime(changed_at, ?1)), '') FROM nickname_history
+		WHERE user_id = ?2 AND datetime(changed_at, ?1) > CURRENT_TIMESTAMP`,
+		fmt.Sprintf("+%d seconds", int64(NicknameChangeCooldown.Seconds())), userID).Scan(&nextChange)
+	if err != nil {
+		return "", err
+	}
+	if nextChange != "" {
+		return nextChange, errNicknameCooldown
+	}
+
+	if _, err := tx.Exec(`DELETE FROM nickname_history WHERE user_id = ? AND nickname = ?`, userID, newNickname); err != nil {
+		return "", err
+	}
+	if oldNickname == "" {
+		return "", nil
+	}
+	_, err = tx.Exec(`
+		INSERT INTO nickname_history (id, user_id, nickname, changed_at, reserved_until)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP, datetime('now', ?))`,
+		uuid.New().String(), userID, oldNickname, fmt.Sprintf("+%d seconds", int64(NicknameGracePeriod.Seconds())))
+	return "", err
+}
+
+// ResolveNicknameHandler looks up the account behind an @handle, following nicknames changed within
+// the grace period to the current one
+func ResolveNicknameHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		nickname := r.URL.Query().Get("nickname")
+		if nickname == "" {
+			http.Error(w, "Missing nickname", http.StatusBadRequest)
+			return
+		}
+
+		targetID, redirected, err := ResolveNickname(db, nickname)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to resolve nickname", http.StatusInternalServerError)
+			return
+		}
+
+		// Users who blocked the viewer are hidden the same way their profile is
+		var current string
+		var blockedByTarget bool
+		err = db.QueryRow(`
+			SELECT COALESCE(nickname, ''), EXISTS(SELECT 1 FROM blocks WHERE blocker_id = users.id AND blocked_id = ?)
+			FROM users WHERE id = ?`, userID, targetID).Scan(&current, &blockedByTarget)
+		if err != nil {
+			http.Error(w, "Failed to resolve nickname", http.StatusInternalServerError)
+			return
+		}
+		if blockedByTarget {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"user_id":    targetID,
+			"nickname":   current,
+			"redirected": redirected,
+		})
+	}
+}
@@ -3,11 +3,59 @@ package users
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"social-network/app/followers"
 	"social-network/app/sessions"
 )
 
+// setPrivacy stores the user's privacy setting and returns the response body describing what
+// happened to their follow graph. Going public can accept every pending follow request when
+// acceptPending is set; otherwise the requests stay pending and are counted so the client can ask.
+// Going private keeps existing followers and returns the first page of them to review.
+func setPrivacy(db *sql.DB, userID string, private, acceptPending bool) (map[string]interface{}, error) {
+	if _, err := db.Exec(`UPDATE users SET private = ? WHERE id = ?`, private, userID); err != nil {
+		return nil, err
+	}
+
+	response := map[string]interface{}{
+		"message": "Privacy setting updated successfully",
+		"private": private,
+	}
+
+	if private {
+		// Existing followers keep access. The first page of them is returned for review; the client
+		// pages through the rest with /followers and drops anyone unwanted with /followers/remove.
+		const reviewPageSize = 20
+		users, total, err := followers.FollowersPage(db, userID, 1, reviewPageSize)
+		if err != nil {
+			return nil, err
+		}
+		response["followers_to_review"] = total
+		response["followers"] = users
+		response["followers_url"] = fmt.Sprintf("/followers?page=1&limit=%d", reviewPageSize)
+		return response, nil
+	}
+
+	if acceptPending {
+		accepted, err := followers.RespondToFollowRequests(db, userID, nil, true)
+		if err != nil {
+			return nil, err
+		}
+		response["accepted_requests"] = len(accepted)
+	}
+
+	var pendingCount int
+	err := db.QueryRow(`SELECT COUNT(*) FROM followers WHERE followed_id = ? AND status = 'pending'`, userID).Scan(&pendingCount)
+	if err != nil {
+		return nil, err
+	}
+	response["pending_requests"] = pendingCount
+	return response, nil
+}
+
+// UpdatePrivacyHandler sets the logged-in user's profile to private or public
 func UpdatePrivacyHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPut {
@@ -16,7 +64,7 @@ func UpdatePrivacyHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		// the logged-in user ID from session
-		userID, err := sessions.GetUserIDFromSession(r)
+		userID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
 			return
@@ -24,7 +72,8 @@ func UpdatePrivacyHandler(db *sql.DB) http.HandlerFunc {
 
 		// Parse the request body
 		var request struct {
-			Private *bool `json:"private"` // Use a pointer to distinguish between missing and false
+			Private       *bool `json:"private"` // Use a pointer to distinguish between missing and false
+			AcceptPending bool  `json:"accept_pending"`
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
@@ -40,15 +89,15 @@ func UpdatePrivacyHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		// Update the privacy setting for the logged-in user
-		_, err = db.Exec(`UPDATE users SET private = ? WHERE id = ?`, *request.Private, userID)
+		response, err := setPrivacy(db, userID, *request.Private, request.AcceptPending)
 		if err != nil {
 			log.Printf("Error updating user privacy: %v", err)
 			http.Error(w, "Failed to update privacy setting", http.StatusInternalServerError)
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("Privacy setting updated successfully"))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
 	}
 }
 
@@ -9,6 +9,8 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"social-network/app/auth"
+	"social-network/app/followers"
 	"social-network/app/posts"
 	"social-network/app/sessions"
 	"strings"
@@ -16,33 +18,30 @@ import (
 	"github.com/google/uuid"
 )
 
-// User represents basic user info for followers and following lists
-type User struct {
-	ID       string `json:"id"`
-	Nickname string `json:"nickname"`
-	Avatar   string `json:"avatar,omitempty"`
-}
-
 // Updated UserProfile struct
 type UserProfile struct {
-	ID             string       `json:"id"`
-	Email          string       `json:"email"`
-	FirstName      string       `json:"first_name"`
-	LastName       string       `json:"last_name"`
-	Nickname       string       `json:"nickname,omitempty"`
-	AboutMe        string       `json:"about_me,omitempty"`
-	Avatar         string       `json:"avatar,omitempty"`
-	DateOfBirth    string       `json:"date_of_birth"`
-	Private        bool         `json:"private"`
-	FollowersCount int          `json:"followers_count"`
-	FollowingCount int          `json:"following_count"`
-	Followers      []User       `json:"followers"`  // New: list of followers
-	Following      []User       `json:"following"`  // New: list of following users
-	Posts          []posts.Post `json:"posts"`
-	Pending string         `json:"pending"`
+	ID              string           `json:"id"`
+	Email           string           `json:"email"`
+	FirstName       string           `json:"first_name"`
+	LastName        string           `json:"last_name"`
+	Nickname        string           `json:"nickname,omitempty"`
+	AboutMe         string           `json:"about_me,omitempty"`
+	Avatar          string           `json:"avatar,omitempty"`
+	DateOfBirth     string           `json:"date_of_birth"`
+	Private         bool             `json:"private"`
+	CoverImage      string           `json:"cover_image,omitempty"`
+	Location        string           `json:"location,omitempty"`
+	Pronouns        string           `json:"pronouns,omitempty"`
+	Links           []ProfileLink    `json:"links"`
+	PinnedPost      *posts.Post      `json:"pinned_post,omitempty"`
+	FollowersCount  int              `json:"followers_count"`
+	FollowingCount  int              `json:"following_count"`
+	Posts           []posts.Post     `json:"posts"`
+	Pending         string           `json:"pending"`
+	FieldVisibility *FieldVisibility `json:"field_visibility,omitempty"` // Only sent to the owner
 }
 
-// GetUserProfileHandler fetches profile info including follower and following details
+// GetUserProfileHandler fetches profile info with follower and following counts
 func GetUserProfileHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -57,7 +56,7 @@ func GetUserProfileHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		// Get logged-in user ID
-		loggedInUserID, err := sessions.GetUserIDFromSession(r)
+		loggedInUserID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
@@ -66,6 +65,21 @@ func GetUserProfileHandler(db *sql.DB) http.HandlerFunc {
 		// Check if the logged-in user is viewing their own profile
 		isMyProfile := loggedInUserID == profileID
 
+		// A user who has been blocked by the profile owner cannot see the profile at all
+		var blockedByOwner bool
+		err = db.QueryRow(
+			`SELECT EXISTS(SELECT 1 FROM blocks WHERE blocker_id = ? AND blocked_id = ?)`,
+			profileID, loggedInUserID,
+		).Scan(&blockedByOwner)
+		if err != nil {
+			http.Error(w, "Failed to check block status", http.StatusInternalServerError)
+			return
+		}
+		if blockedByOwner {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
 		// Check if the logged-in user is following the profile owner
 		var isFollowing bool
 		err = db.QueryRow(
@@ -75,11 +89,17 @@ func GetUserProfileHandler(db *sql.DB) http.HandlerFunc {
 
 		// Fetch profile data
 		var profile UserProfile
+		var visibility FieldVisibility
+		var pinnedPostID string
 		err = db.QueryRow(`
-			SELECT id, email, first_name, last_name, nickname, about_me, avatar, date_of_birth, private
+			SELECT id, email, first_name, last_name, nickname, about_me, avatar, date_of_birth, private,
+			       COALESCE(cover_image, ''), COALESCE(location, ''), COALESCE(pronouns, ''), COALESCE(pinned_post_id, ''),
+			       email_visibility, birthday_visibility, name_visibility, about_visibility
 			FROM users WHERE id = ?`, profileID).Scan(
 			&profile.ID, &profile.Email, &profile.FirstName, &profile.LastName,
-			&profile.Nickname, &profile.AboutMe, &profile.Avatar, &profile.DateOfBirth, &profile.Private)
+			&profile.Nickname, &profile.AboutMe, &profile.Avatar, &profile.DateOfBirth, &profile.Private,
+			&profile.CoverImage, &profile.Location, &profile.Pronouns, &pinnedPostID,
+			&visibility.Email, &visibility.DateOfBirth, &visibility.FullName, &visibility.AboutMe)
 		if errors.Is(err, sql.ErrNoRows) {
 			http.Error(w, "User not found", http.StatusNotFound)
 			return
@@ -96,12 +116,31 @@ func GetUserProfileHandler(db *sql.DB) http.HandlerFunc {
 		// Check if the user has a pending follow request
 		db.QueryRow(`SELECT EXISTS(SELECT 1 FROM followers WHERE follower_id = ? AND followed_id = ? AND status = 'pending')`, loggedInUserID, profileID).Scan(&profile.Pending)
 
-		// If the profile is private and the requester is NOT the owner or a follower, return limited info.
+		relationship, err := followers.GetRelationship(db, loggedInUserID, profileID)
+		if err != nil {
+			http.Error(w, "Failed to fetch relationship", http.StatusInternalServerError)
+			return
+		}
+
+		// Blank the fields the viewer is not allowed to see
+		visibility.hideFields(&profile, relationship)
+		if isMyProfile {
+			profile.FieldVisibility = &visibility
+		}
+
+		// If the profile is private and the requester is NOT the owner or a follower, return limited info
+		// with only the fields their owner made public.
 		if profile.Private && !isMyProfile && !isFollowing {
 			response := struct {
 				ID          string `json:"id"`
 				Nickname    string `json:"nickname"`
+				FirstName   string `json:"first_name,omitempty"`
+				LastName    string `json:"last_name,omitempty"`
+				Email       string `json:"email,omitempty"`
+				DateOfBirth string `json:"date_of_birth,omitempty"`
+				AboutMe     string `json:"about_me,omitempty"`
 				Avatar      string `json:"avatar,omitempty"`
+				CoverImage  string `json:"cover_image,omitempty"`
 				Private     bool   `json:"private"`
 				Followers   int    `json:"followers_count"`
 				Following   int    `json:"following_count"`
@@ -109,10 +148,17 @@ func GetUserProfileHandler(db *sql.DB) http.HandlerFunc {
 				IsMyProfile bool   `json:"is_my_profile"`
 				Message     string `json:"message"`
 				Pending     string `json:"pending"`
+				Relationship followers.Relationship `json:"relationship"`
 			}{
 				ID:          profile.ID,
 				Nickname:    profile.Nickname,
+				FirstName:   profile.FirstName,
+				LastName:    profile.LastName,
+				Email:       profile.Email,
+				DateOfBirth: profile.DateOfBirth,
+				AboutMe:     profile.AboutMe,
 				Avatar:      profile.Avatar,
+				CoverImage:  profile.CoverImage,
 				Private:     profile.Private,
 				Followers:   profile.FollowersCount,
 				Following:   profile.FollowingCount,
@@ -120,6 +166,7 @@ func GetUserProfileHandler(db *sql.DB) http.HandlerFunc {
 				IsMyProfile: isMyProfile,
 				Message:     "This profile is private. You must follow to see more details.",
 				Pending:     profile.Pending,
+				Relationship: relationship,
 			}
 
 			w.Header().Set("Content-Type", "application/json")
@@ -127,38 +174,6 @@ func GetUserProfileHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Fetch followers details
-		rows, err := db.Query(`
-			SELECT users.id, users.nickname, users.avatar 
-			FROM followers 
-			JOIN users ON followers.follower_id = users.id 
-			WHERE followers.followed_id = ? AND followers.status = 'accepted'`, profileID)
-		if err == nil {
-			defer rows.Close()
-			for rows.Next() {
-				var follower User
-				if err := rows.Scan(&follower.ID, &follower.Nickname, &follower.Avatar); err == nil {
-					profile.Followers = append(profile.Followers, follower)
-				}
-			}
-		}
-
-		// Fetch following details
-		rows, err = db.Query(`
-			SELECT users.id, users.nickname, users.avatar 
-			FROM followers 
-			JOIN users ON followers.followed_id = users.id 
-			WHERE followers.follower_id = ? AND followers.status = 'accepted'`, profileID)
-		if err == nil {
-			defer rows.Close()
-			for rows.Next() {
-				var following User
-				if err := rows.Scan(&following.ID, &following.Nickname, &following.Avatar); err == nil {
-					profile.Following = append(profile.Following, following)
-				}
-			}
-		}
-
 		// Fetch user posts with proper privacy filtering
 		var postRows *sql.Rows
 		query := `
@@ -168,6 +183,7 @@ func GetUserProfileHandler(db *sql.DB) http.HandlerFunc {
 			FROM posts
 			INNER JOIN users ON posts.user_id = users.id
 			WHERE posts.user_id = ?
+			AND posts.hidden = 0
 			AND (
 				posts.privacy = 'public'
 				OR (posts.privacy = 'almost-private' AND (posts.user_id = ? OR EXISTS(
@@ -175,13 +191,22 @@ func GetUserProfileHandler(db *sql.DB) http.HandlerFunc {
 				)))
 				OR (posts.privacy = 'private' AND (posts.user_id = ? OR EXISTS(
 					SELECT 1 FROM post_privacy WHERE post_id = posts.id AND user_id = ?
+				) OR EXISTS(
+					SELECT 1 FROM post_audiences
+					JOIN audience_members ON audience_members.audience_id = post_audiences.audience_id
+					WHERE post_audiences.post_id = posts.id AND audience_members.user_id = ?
 				)))
 			)
+			AND NOT EXISTS(
+				SELECT 1 FROM blocks
+				WHERE (blocker_id = posts.user_id AND blocked_id = ?)
+				   OR (blocker_id = ? AND blocked_id = posts.user_id)
+			)
 			ORDER BY posts.created_at DESC;
 		`
 
 		// Pass userID multiple times as required in the query
-		postRows, err = db.Query(query, loggedInUserID, profileID, loggedInUserID, loggedInUserID, loggedInUserID, loggedInUserID)
+		postRows, err = db.Query(query, loggedInUserID, profileID, loggedInUserID, loggedInUserID, loggedInUserID, loggedInUserID, loggedInUserID, loggedInUserID, loggedInUserID)
 		if err != nil {
 			http.Error(w, "Failed to fetch posts", http.StatusInternalServerError)
 			return
@@ -200,16 +225,36 @@ func GetUserProfileHandler(db *sql.DB) http.HandlerFunc {
 			}
 			profile.Posts = append(profile.Posts, post)
 		}
+		if err := posts.LoadEntities(db, profile.Posts); err != nil {
+			http.Error(w, "Failed to fetch mentions", http.StatusInternalServerError)
+			return
+		}
+
+		// The pinned post is only shown when the viewer can see it among the posts above
+		for i := range profile.Posts {
+			if profile.Posts[i].ID == pinnedPostID {
+				profile.PinnedPost = &profile.Posts[i]
+				break
+			}
+		}
+
+		profile.Links, err = getProfileLinks(db, profileID)
+		if err != nil {
+			http.Error(w, "Failed to fetch profile links", http.StatusInternalServerError)
+			return
+		}
 
 		// Include isFollowing and isMyProfile in all responses
 		response := struct {
 			UserProfile
 			IsFollowing bool `json:"is_following"`
 			IsMyProfile bool `json:"is_my_profile"`
+			Relationship followers.Relationship `json:"relationship"`
 		}{
 			UserProfile: profile,
 			IsFollowing: isFollowing,
 			IsMyProfile: isMyProfile,
+			Relationship: relationship,
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -230,14 +275,15 @@ func TogglePrivacyHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		userID, err := sessions.GetUserIDFromSession(r)
+		userID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
 		var request struct {
-			Private bool `json:"private"` // Match the correct database column name
+			Private       bool `json:"private"` // Match the correct database column name
+			AcceptPending bool `json:"accept_pending"`
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
@@ -245,14 +291,14 @@ func TogglePrivacyHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Ensure the SQL query uses the correct column name: `private`
-		_, err = db.Exec(`UPDATE users SET private = ? WHERE id = ?`, request.Private, userID)
+		response, err := setPrivacy(db, userID, request.Private, request.AcceptPending)
 		if err != nil {
 			http.Error(w, "Failed to update privacy setting: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		w.Write([]byte("Privacy setting updated successfully"))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
 	}
 }
 
@@ -268,7 +314,7 @@ func UpdateProfileHandler(db *sql.DB) http.HandlerFunc {
 		}
 
 		// Get logged-in user ID.
-		userID, err := sessions.GetUserIDFromSession(r)
+		userID, err := sessions.UserIDFromContext(r.Context())
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
@@ -283,8 +329,10 @@ func UpdateProfileHandler(db *sql.DB) http.HandlerFunc {
 			Nickname  string `json:"nickname,omitempty"`
 			AboutMe   string `json:"about_me,omitempty"`
 			Avatar    string `json:"avatar,omitempty"`
+			profileDetails
 		}
 		var update updateData
+		var coverImage string
 
 		if strings.HasPrefix(contentType, "multipart/form-data") {
 			const maxUploadSize = 10 << 20
@@ -297,24 +345,33 @@ func UpdateProfileHandler(db *sql.DB) http.HandlerFunc {
 			update.LastName = r.FormValue("last_name")
 			update.Nickname = r.FormValue("nickname")
 			update.AboutMe = r.FormValue("about_me")
+			if err := update.readForm(r.MultipartForm); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
 			if update.FirstName == "" || update.LastName == "" {
 				http.Error(w, "First and last names cannot be empty", http.StatusBadRequest)
 				return
 			}
-			// Check for duplicate nickname.
+			// Check for duplicate nickname, including ones reserved after a change.
 			if update.Nickname != "" {
-				var count int
-				err = db.QueryRow("SELECT COUNT(*) FROM users WHERE nickname = ? AND id != ?", update.Nickname, userID).Scan(&count)
+				taken, err := auth.NicknameTaken(db, update.Nickname, userID)
 				if err != nil {
 					http.Error(w, "Database error", http.StatusInternalServerError)
 					return
 				}
-				if count > 0 {
+				if taken {
 					http.Error(w, "Nickname already taken", http.StatusBadRequest)
 					return
 				}
 			}
 
+			// Process cover image file.
+			var ok bool
+			if coverImage, ok = readCoverImage(w, r); !ok {
+				return
+			}
+
 			// Process avatar file.
 			file, fileHeader, err := r.FormFile("avatar")
 			if err == nil {
@@ -374,21 +431,50 @@ func UpdateProfileHandler(db *sql.DB) http.HandlerFunc {
 				return
 			}
 			if update.Nickname != "" {
-				var count int
-				err = db.QueryRow("SELECT COUNT(*) FROM users WHERE nickname = ? AND id != ?", update.Nickname, userID).Scan(&count)
+				taken, err := auth.NicknameTaken(db, update.Nickname, userID)
 				if err != nil {
 					http.Error(w, "Database error", http.StatusInternalServerError)
 					return
 				}
-				if count > 0 {
+				if taken {
 					http.Error(w, "Nickname already taken", http.StatusBadRequest)
 					return
 				}
 			}
 		}
 
+		if err := update.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Failed to update profile", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		// Keep the old nickname pointing at this account for a while, unless it changed too recently
+		var currentNickname string
+		if err := tx.QueryRow("SELECT COALESCE(nickname, '') FROM users WHERE id = ?", userID).Scan(&currentNickname); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to update profile: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if update.Nickname != currentNickname {
+			nextChange, err := changeNickname(tx, userID, currentNickname, update.Nickname)
+			if errors.Is(err, errNicknameCooldown) {
+				http.Error(w, "Nickname can only be changed once every 7 days, next change allowed after "+nextChange+" UTC",
+					http.StatusTooManyRequests)
+				return
+			} else if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to update profile: %v", err), http.StatusInternalServerError)
+				return
+			}
+		}
+
 		// Update the user's profile.
-		_, err = db.Exec(
+		_, err = tx.Exec(
 			"UPDATE users SET first_name = ?, last_name = ?, nickname = ?, about_me = ?, avatar = ? WHERE id = ?",
 			update.FirstName, update.LastName, update.Nickname, update.AboutMe, update.Avatar, userID,
 		)
@@ -396,6 +482,23 @@ func UpdateProfileHandler(db *sql.DB) http.HandlerFunc {
 			http.Error(w, fmt.Sprintf("Failed to update profile: %v", err), http.StatusInternalServerError)
 			return
 		}
+		if coverImage != "" {
+			if _, err := tx.Exec("UPDATE users SET cover_image = ? WHERE id = ?", coverImage, userID); err != nil {
+				http.Error(w, fmt.Sprintf("Failed to update profile: %v", err), http.StatusInternalServerError)
+				return
+			}
+		}
+		if err := update.save(tx, userID); errors.Is(err, errPinnedNotOwnPost) {
+			http.Error(w, "Only one of your own posts can be pinned", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to update profile: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to update profile: %v", err), http.StatusInternalServerError)
+			return
+		}
 
 		w.Write([]byte("Profile updated successfully"))
 	}
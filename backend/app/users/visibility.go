@@ -0,0 +1,125 @@
+package users
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"social-network/app/followers"
+	"social-network/app/sessions"
+)
+
+// Audiences a profile field can be shown to
+const (
+	VisibilityPublic    = "public"
+	VisibilityFollowers = "followers"
+	VisibilityOnlyMe    = "only_me"
+)
+
+// FieldVisibility holds who may see each of a user's personal profile fields
+type FieldVisibility struct {
+	Email       string `json:"email"`
+	DateOfBirth string `json:"date_of_birth"`
+	FullName    string `json:"full_name"`
+	AboutMe     string `json:"about_me"`
+}
+
+// validVisibility reports whether level is one of the known audiences
+func validVisibility(level string) bool {
+	return level == VisibilityPublic || level == VisibilityFollowers || level == VisibilityOnlyMe
+}
+
+// CanViewField reports whether a viewer with the given relationship to the owner may see a field
+// shown to level. Unknown levels are treated as only me.
+func CanViewField(level string, rel followers.Relationship) bool {
+	switch level {
+	case VisibilityPublic:
+		return true
+	case VisibilityFollowers:
+		return rel.IsSelf || rel.Following
+	default:
+		return rel.IsSelf
+	}
+}
+
+// EffectiveVisibility returns the audience a field is actually shown to. A private profile only
+// shows itself to followers, so its public fields are treated as followers-only.
+func EffectiveVisibility(level string, private bool) string {
+	if private && level == VisibilityPublic {
+		return VisibilityFollowers
+	}
+	return level
+}
+
+// GetFieldVisibility loads the field visibility settings of a user
+func GetFieldVisibility(db *sql.DB, userID string) (FieldVisibility, error) {
+	var v FieldVisibility
+	err := db.QueryRow(`
+		SELECT email_visibility, birthday_visibility, name_visibility, about_visibility
+		FROM users WHERE id = ?`, userID).Scan(&v.Email, &v.DateOfBirth, &v.FullName, &v.AboutMe)
+	return v, err
+}
+
+// hideFields blanks the fields of a profile the viewer is not allowed to see
+func (v FieldVisibility) hideFields(profile *UserProfile, rel followers.Relationship) {
+	if !CanViewField(EffectiveVisibility(v.Email, profile.Private), rel) {
+		profile.Email = ""
+	}
+	if !CanViewField(EffectiveVisibility(v.DateOfBirth, profile.Private), rel) {
+		profile.DateOfBirth = ""
+	}
+	if !CanViewField(EffectiveVisibility(v.FullName, profile.Private), rel) {
+		profile.FirstName = ""
+		profile.LastName = ""
+	}
+	if !CanViewField(EffectiveVisibility(v.AboutMe, profile.Private), rel) {
+		profile.AboutMe = ""
+	}
+}
+
+// UpdateFieldVisibilityHandler changes who may see the logged-in user's email, birthday, full name
+// and about-me. Fields left out of the request keep their current setting.
+func UpdateFieldVisibilityHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, err := sessions.UserIDFromContext(r.Context())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		visibility, err := GetFieldVisibility(db, userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch visibility settings", http.StatusInternalServerError)
+			return
+		}
+
+		// Decode on top of the current settings so only the fields sent are changed
+		if err := json.NewDecoder(r.Body).Decode(&visibility); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		for _, level := range []string{visibility.Email, visibility.DateOfBirth, visibility.FullName, visibility.AboutMe} {
+			if !validVisibility(level) {
+				http.Error(w, "Invalid visibility, must be 'public', 'followers' or 'only_me'", http.StatusBadRequest)
+				return
+			}
+		}
+
+		_, err = db.Exec(`
+			UPDATE users SET email_visibility = ?, birthday_visibility = ?, name_visibility = ?, about_visibility = ?
+			WHERE id = ?`, visibility.Email, visibility.DateOfBirth, visibility.FullName, visibility.AboutMe, userID)
+		if err != nil {
+			log.Printf("Error updating field visibility: %v", err)
+			http.Error(w, "Failed to update visibility settings", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(visibility)
+	}
+}
@@ -0,0 +1,232 @@
+// Command mockidp is a minimal OpenID Connect provider for developing and testing social login.
+// It supports the authorization code flow with PKCE and signs ID tokens with a key generated at startup.
+//
+// Run it with `go run ./cmd/mockidp` and start the backend with:
+//
+//	OIDC_PROVIDERS=mock OIDC_MOCK_ISSUER=http://localhost:9000 OIDC_MOCK_CLIENT_ID=social-network
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"html/template"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// authorization is a code issued by /authorize and redeemed at /token
+type authorization struct {
+	ClientID      string
+	RedirectURI   string
+	CodeChallenge string
+	Nonce         string
+	Email         string
+	Name          string
+	ExpiresAt     time.Time
+}
+
+var (
+	issuer   string
+	clientID string
+	key      *rsa.PrivateKey
+
+	codesMu sync.Mutex
+	codes   = make(map[string]authorization)
+)
+
+var consentPage = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html><body>
+<h1>Mock identity provider</h1>
+<form method="POST">
+{{range $name, $values := .}}{{range $values}}<input type="hidden" name="{{$name}}" value="{{.}}">{{end}}{{end}}
+<label>Email <input name="email" value="jane.doe@example.com"></label>
+<label>Name <input name="name" value="Jane Doe"></label>
+<button type="submit">Sign in</button>
+</form>
+</body></html>`))
+
+func main() {
+	addr := flag.String("addr", ":9000", "listen address")
+	flag.StringVar(&issuer, "issuer", "http://localhost:9000", "issuer URL advertised to clients")
+	flag.StringVar(&clientID, "client-id", "social-network", "accepted client ID")
+	flag.Parse()
+
+	var err error
+	key, err = rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatalf("Failed to generate signing key: %v", err)
+	}
+
+	http.HandleFunc("/.well-known/openid-configuration", discoveryHandler)
+	http.HandleFunc("/authorize", authorizeHandler)
+	http.HandleFunc("/token", tokenHandler)
+	http.HandleFunc("/jwks", jwksHandler)
+
+	log.Printf("Mock identity provider running on %s (issuer %s)", *addr, issuer)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
+
+func discoveryHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/authorize",
+		"token_endpoint":                        issuer + "/token",
+		"jwks_uri":                              issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+// authorizeHandler shows a consent form on GET and issues a code on POST
+func authorizeHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if r.Method == http.MethodGet {
+		consentPage.Execute(w, r.Form)
+		return
+	}
+
+	if r.FormValue("client_id") != clientID || r.FormValue("response_type") != "code" {
+		http.Error(w, "Unknown client or unsupported response type", http.StatusBadRequest)
+		return
+	}
+	if r.FormValue("code_challenge_method") != "S256" || r.FormValue("code_challenge") == "" {
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+	redirectURI, err := url.Parse(r.FormValue("redirect_uri"))
+	if err != nil || redirectURI.Scheme == "" {
+		http.Error(w, "Invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString()
+	codesMu.Lock()
+	codes[code] = authorization{
+		ClientID:      clientID,
+		RedirectURI:   r.FormValue("redirect_uri"),
+		CodeChallenge: r.FormValue("code_challenge"),
+		Nonce:         r.FormValue("nonce"),
+		Email:         strings.TrimSpace(r.FormValue("email")),
+		Name:          strings.TrimSpace(r.FormValue("name")),
+		ExpiresAt:     time.Now().Add(time.Minute),
+	}
+	codesMu.Unlock()
+
+	query := redirectURI.Query()
+	query.Set("code", code)
+	query.Set("state", r.FormValue("state"))
+	redirectURI.RawQuery = query.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// tokenHandler redeems a code after checking the client, redirect URI and PKCE verifier
+func tokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	codesMu.Lock()
+	auth, ok := codes[r.FormValue("code")]
+	delete(codes, r.FormValue("code"))
+	codesMu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+	switch {
+	case !ok || time.Now().After(auth.ExpiresAt):
+		tokenError(w, "invalid_grant")
+		return
+	case r.FormValue("client_id") != auth.ClientID || r.FormValue("redirect_uri") != auth.RedirectURI:
+		tokenError(w, "invalid_client")
+		return
+	case base64.RawURLEncoding.EncodeToString(verifier[:]) != auth.CodeChallenge:
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	subject := sha256.Sum256([]byte(strings.ToLower(auth.Email)))
+	given, family, _ := strings.Cut(auth.Name, " ")
+	idToken, err := signJWT(map[string]interface{}{
+		"iss":            issuer,
+		"sub":            base64.RawURLEncoding.EncodeToString(subject[:12]),
+		"aud":            auth.ClientID,
+		"exp":            time.Now().Add(5 * time.Minute).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          auth.Nonce,
+		"email":          auth.Email,
+		"email_verified": true,
+		"name":           auth.Name,
+		"given_name":     given,
+		"family_name":    family,
+	})
+	if err != nil {
+		http.Error(w, "Failed to sign token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func jwksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "mock",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	})
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"error": code})
+}
+
+// signJWT encodes and signs the claims with RS256
+func signJWT(claims map[string]interface{}) (string, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": "mock"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func randomString() string {
+	buf := make([]byte, 24)
+	rand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
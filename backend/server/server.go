@@ -3,19 +3,29 @@ package server
 import (
 	"log"
 	"net/http"
+	"social-network/app/account"
+	"social-network/app/admin"
+	"social-network/app/audiences"
 	"social-network/app/auth"
+	"social-network/app/blocks"
 	"social-network/app/chat"
 	"social-network/app/comments"
 	"social-network/app/db/sqlite"
 	"social-network/app/events"
 	"social-network/app/followers"
 	"social-network/app/groups"
+	"social-network/app/hashtags"
 	"social-network/app/likes"
+	"social-network/app/mailer"
+	"social-network/app/moderation"
+	"social-network/app/mutes"
 	"social-network/app/notifications"
 	"social-network/app/posts"
+	"social-network/app/ratelimit"
 	"social-network/app/search"
 	"social-network/app/sessions"
 	"social-network/app/users"
+	"time"
 )
 
 func Serverinit() {
@@ -29,115 +39,243 @@ func Serverinit() {
 	// Assign the database connection to the sessions package
 	sessions.DB = db
 
-	// Create a new ServeMux to manage routes
+	// Purge expired sessions in the background
+	sessions.StartSessionReaper(db, time.Hour)
+
+	// Delete accounts whose deletion grace period has ended
+	account.StartDeletionReaper(db, time.Hour)
+
+	// Remind followers of upcoming birthdays
+	users.StartBirthdayReminders(db, time.Hour)
+
+	// Outgoing email (SMTP when configured, otherwise written to MAIL_DIR or the log)
+	mail := mailer.FromEnv()
+
+	// External identity providers for social login
+	oidcProviders := auth.LoadOIDCProviders()
+
+	// Rate limits: a global budget per IP and per user, plus tighter limits on sensitive routes
+	ipLimiter := ratelimit.NewLimiter(30, 150)
+	userLimiter := ratelimit.NewLimiter(10, 50)
+	loginLimiter := ratelimit.NewLimiter(ratelimit.PerMinute(10), 10)
+	signupLimiter := ratelimit.NewLimiter(ratelimit.PerMinute(3), 5)
+	emailLimiter := ratelimit.NewLimiter(ratelimit.PerMinute(3), 5)
+	contentLimiter := ratelimit.NewLimiter(ratelimit.PerMinute(20), 10)
+	socketLimiter := ratelimit.NewLimiter(ratelimit.PerMinute(30), 10)
+	exportLimiter := ratelimit.NewLimiter(ratelimit.PerMinute(1), 2)
+
+	// Create a new ServeMux to manage routes. Routes on mux are public; everything registered on
+	// protected is only reached through auth.AuthMiddleware, which loads the user into the context.
 	mux := http.NewServeMux()
+	protected := http.NewServeMux()
+
+	// Roles allowed through auth.RequireRole
+	staffRoles := []string{"moderator", "admin"}
+	adminRoles := []string{"admin"}
 
 	// Public Routes
-	mux.HandleFunc("/register", auth.RegisterHandler(db))
-	mux.HandleFunc("/login", auth.LoginHandler(db))
-	mux.HandleFunc("/logout", auth.LogoutHandler(db)) 
+	mux.Handle("/register", ratelimit.PerIP(signupLimiter, auth.RegisterHandler(db, mail)))
+	mux.Handle("/login", ratelimit.PerIP(loginLimiter, auth.LoginHandler(db)))
+
+	// Account sessions
+	protected.HandleFunc("/sessions", sessions.GetSessionsHandler(db))                      // List the user's signed-in devices
+	protected.HandleFunc("/sessions/revoke", sessions.RevokeSessionHandler(db))             // Sign out one device
+	protected.HandleFunc("/sessions/revoke-others", sessions.RevokeOtherSessionsHandler(db)) // Sign out everywhere else
+	protected.HandleFunc("/password/change", auth.ChangePasswordHandler(db))
+	protected.HandleFunc("/logout", auth.LogoutHandler(db))
+
+	// Two-factor authentication
+	mux.Handle("/login/2fa", ratelimit.PerIP(loginLimiter, auth.VerifyLoginHandler(db)))   // Second login step
+	protected.HandleFunc("/2fa", auth.GetTwoFactorStatusHandler(db))                        // Whether 2FA is on
+	protected.HandleFunc("/2fa/setup", auth.SetupTwoFactorHandler(db))                      // Generate secret and provisioning URI
+	protected.HandleFunc("/2fa/enable", auth.EnableTwoFactorHandler(db))                    // Confirm a code and get recovery codes
+	protected.HandleFunc("/2fa/disable", auth.DisableTwoFactorHandler(db))                  // Requires password and a code
+	protected.HandleFunc("/2fa/recovery-codes", auth.RegenerateRecoveryCodesHandler(db))    // Replace recovery codes
+
+	// Bearer tokens for non-browser clients
+	mux.Handle("/auth/token", ratelimit.PerIP(loginLimiter, auth.IssueTokenHandler(db)))   // Credentials for an access/refresh pair
+	mux.HandleFunc("/auth/token/refresh", auth.RefreshTokenHandler(db))                     // Rotate a token pair
+	mux.HandleFunc("/auth/token/revoke", auth.RevokeTokenHandler(db))                       // Revoke any token by value
+	protected.HandleFunc("/tokens", auth.CreatePersonalTokenHandler(db))                    // Create a personal access token
+	protected.HandleFunc("/tokens/all", auth.GetPersonalTokensHandler(db))                  // List personal access tokens
+	protected.HandleFunc("/tokens/revoke", auth.DeletePersonalTokenHandler(db))             // Revoke a personal access token
+
+	// Social login (OpenID Connect)
+	mux.HandleFunc("/oauth/providers", auth.GetOIDCProvidersHandler(oidcProviders))             // Configured providers
+	mux.Handle("/oauth/login", ratelimit.PerIP(loginLimiter, auth.OIDCLoginHandler(db, oidcProviders))) // Redirect to the provider
+	mux.HandleFunc("/oauth/callback", auth.OIDCCallbackHandler(db, oidcProviders))          // Provider redirects back here
+	protected.HandleFunc("/oauth/link", auth.OIDCLinkHandler(db, oidcProviders))            // Link a provider to the logged-in user
+	protected.HandleFunc("/oauth/identities", auth.GetLinkedIdentitiesHandler(db))          // Linked providers
+	protected.HandleFunc("/oauth/unlink", auth.UnlinkIdentityHandler(db))                   // Remove a linked provider
+
+	// Data export and account deletion
+	protected.Handle("/account/export", ratelimit.PerUser(exportLimiter, account.ExportDataHandler(db))) // Download a zip of the user's data
+	protected.HandleFunc("/account/deletion", account.GetDeletionStatusHandler(db))                     // Whether a deletion is pending
+	protected.HandleFunc("/account/delete", account.RequestDeletionHandler(db, mail))                   // Schedule deletion after the grace period
+	protected.HandleFunc("/account/delete/cancel", account.CancelDeletionHandler(db))                   // Keep the account
+
+	// Password reset and email verification
+	mux.Handle("/password/forgot", ratelimit.PerIP(emailLimiter, auth.RequestPasswordResetHandler(db, mail)))
+	mux.Handle("/password/reset", ratelimit.PerIP(loginLimiter, auth.ResetPasswordHandler(db)))
+	mux.HandleFunc("/email/verify", auth.VerifyEmailHandler(db))
+	protected.Handle("/email/verify/send", ratelimit.PerUser(emailLimiter, auth.SendVerificationEmailHandler(db, mail)))
 
 	// Posts
-	mux.HandleFunc("/posts", posts.CreatePostHandler(db))
-	mux.HandleFunc("/posts/all", posts.GetPostsHandler(db))
-	mux.HandleFunc("/posts/delete", posts.DeletePostHandler(db))
-	mux.HandleFunc("/posts/like", likes.AddLikeHandler(db))
-	mux.HandleFunc("/posts/unlike", likes.RemoveLikeHandler(db))
+	protected.Handle("/posts", ratelimit.PerUser(contentLimiter, posts.CreatePostHandler(db)))
+	protected.HandleFunc("/posts/all", posts.GetPostsHandler(db))
+	protected.HandleFunc("/posts/delete", posts.DeletePostHandler(db))
+	protected.HandleFunc("/posts/like", likes.AddLikeHandler(db))
+	protected.HandleFunc("/posts/unlike", likes.RemoveLikeHandler(db))
 
 	// Comments
-	mux.HandleFunc("/posts/comments", comments.AddCommentHandler(db))
-	mux.HandleFunc("/posts/comments/delete", comments.DeleteCommentHandler(db))
-	mux.HandleFunc("/posts/comments/all", comments.GetCommentsByPostHandler(db))
+	protected.Handle("/posts/comments", ratelimit.PerUser(contentLimiter, comments.AddCommentHandler(db)))
+	protected.HandleFunc("/posts/comments/delete", comments.DeleteCommentHandler(db))
+	protected.HandleFunc("/posts/comments/all", comments.GetCommentsByPostHandler(db))
+
+	// Hashtags
+	protected.HandleFunc("/hashtags/posts", hashtags.GetTagFeedHandler(db))
+	protected.HandleFunc("/hashtags/trending", hashtags.GetTrendingTagsHandler(db))
 
 	// Post Privacy
-	mux.HandleFunc("/posts/privacy", posts.UpdatePostPrivacyHandler(db))
+	protected.HandleFunc("/posts/privacy", posts.UpdatePostPrivacyHandler(db))
+
+	// Audiences (reusable lists for private posts)
+	protected.HandleFunc("/audiences", audiences.CreateAudienceHandler(db))
+	protected.HandleFunc("/audiences/all", audiences.GetAudiencesHandler(db))
+	protected.HandleFunc("/audiences/delete", audiences.DeleteAudienceHandler(db))
+	protected.HandleFunc("/audiences/members", audiences.GetAudienceMembersHandler(db))
+	protected.HandleFunc("/audiences/members/add", audiences.AddAudienceMemberHandler(db))
+	protected.HandleFunc("/audiences/members/remove", audiences.RemoveAudienceMemberHandler(db))
 
 // Notifications
-mux.HandleFunc("/notifications", notifications.AddNotificationHandler(db))
-mux.HandleFunc("/notifications/get", notifications.GetNotificationsHandler(db))
-mux.HandleFunc("/notifications/read", notifications.MarkNotificationReadHandler(db))
-mux.HandleFunc("/notifications/read-all", notifications.MarkAllNotificationsReadHandler(db))
+protected.HandleFunc("/notifications", notifications.AddNotificationHandler(db))
+protected.HandleFunc("/notifications/get", notifications.GetNotificationsHandler(db))
+protected.HandleFunc("/notifications/read", notifications.MarkNotificationReadHandler(db))
+protected.HandleFunc("/notifications/read-all", notifications.MarkAllNotificationsReadHandler(db))
 
 
 
   	// Followers
-	mux.HandleFunc("/follow", followers.FollowHandler(db))
-	mux.HandleFunc("/unfollow", followers.UnfollowHandler(db))
-	mux.HandleFunc("/followers", followers.GetFollowersHandler(db))
-	mux.HandleFunc("/follow/request", followers.HandleFollowRequest(db))
-	mux.HandleFunc("/follow/requests", followers.GetFollowRequestsHandler(db))
+	protected.HandleFunc("/follow", followers.FollowHandler(db))
+	protected.HandleFunc("/unfollow", followers.UnfollowHandler(db))
+	protected.HandleFunc("/followers", followers.GetFollowersHandler(db))
+	protected.HandleFunc("/following", followers.GetFollowingHandler(db))
+	protected.HandleFunc("/followers/remove", followers.RemoveFollowerHandler(db))
+	protected.HandleFunc("/follow/request", followers.HandleFollowRequest(db))
+	protected.HandleFunc("/follow/request/cancel", followers.CancelFollowRequestHandler(db))
+	protected.HandleFunc("/follow/requests", followers.GetFollowRequestsHandler(db))
+	protected.HandleFunc("/follow/requests/bulk", followers.BulkFollowRequestsHandler(db))
+	protected.HandleFunc("/follow/suggestions", followers.GetSuggestionsHandler(db))
+	protected.HandleFunc("/follow/relationship", followers.GetRelationshipHandler(db))
+
+	// Blocks
+	protected.HandleFunc("/block", blocks.BlockUserHandler(db))
+	protected.HandleFunc("/unblock", blocks.UnblockUserHandler(db))
+	protected.HandleFunc("/blocks", blocks.GetBlockedUsersHandler(db))
+
+	// Mutes
+	protected.HandleFunc("/mute", mutes.MuteUserHandler(db))
+	protected.HandleFunc("/unmute", mutes.UnmuteUserHandler(db))
+	protected.HandleFunc("/mutes", mutes.GetMutedUsersHandler(db))
+	protected.HandleFunc("/mutes/keywords", mutes.AddMutedKeywordHandler(db))
+	protected.HandleFunc("/mutes/keywords/delete", mutes.RemoveMutedKeywordHandler(db))
+	protected.HandleFunc("/mutes/keywords/all", mutes.GetMutedKeywordsHandler(db))
 
 	// User Privacy
-	mux.HandleFunc("/users/privacy", users.UpdatePrivacyHandler(db))
+	protected.HandleFunc("/users/privacy", users.UpdatePrivacyHandler(db))
 
 
 // Groups endpoints
-  mux.HandleFunc("/groups", groups.GetAllGroupsHandler(db))                    // Fetch all groups for browsing
-  mux.HandleFunc("/groups/details", groups.GetGroupDetailsHandler(db)) // Get details of a specific group
-  mux.HandleFunc("/groups/search", groups.SearchGroupsHandler(db))             // Search for groups by name
-  mux.HandleFunc("/groups/create", groups.CreateGroupHandler(db))              // Create a new group
-  mux.HandleFunc("/groups/join", groups.RequestToJoinHandler(db))              // Request to join a group
-  mux.HandleFunc("/groups/join/respond", groups.HandleJoinRequestHandler(db))  // Accept/decline a join request
-  mux.HandleFunc("/groups/invite", groups.SendInvitationHandler(db))           // Send a group invitation
-  mux.HandleFunc("/groups/invite/respond", groups.HandleInvitationHandler(db)) // Accept/decline a group invitation
-  mux.HandleFunc("/groups/leave", groups.LeaveGroupHandler(db))                // Leave a group
-  mux.HandleFunc("/groups/user", groups.GetUserGroupsHandler(db))              // Get all groups a user belongs to
-  mux.HandleFunc("/groups/requests", groups.GetPendingRequestsHandler(db))     // Get all pending join requests for a creator's groups
-  mux.HandleFunc("/groups/remove", groups.RemoveMemberHandler(db))             // Remove a member from a group (only for creator)
-  mux.HandleFunc("/groups/delete", groups.DeleteGroupHandler(db))              // Delete a group (only for creator)
-  mux.HandleFunc("/groups/members", groups.GetGroupMembersHandler(db))         // Get a list of all members in a group
+  protected.HandleFunc("/groups", groups.GetAllGroupsHandler(db))              // Fetch all groups for browsing
+  protected.HandleFunc("/groups/details", groups.GetGroupDetailsHandler(db)) // Get details of a specific group
+  protected.HandleFunc("/groups/search", groups.SearchGroupsHandler(db))       // Search for groups by name
+  protected.HandleFunc("/groups/create", groups.CreateGroupHandler(db))        // Create a new group
+  protected.HandleFunc("/groups/join", groups.RequestToJoinHandler(db))        // Request to join a group
+  protected.HandleFunc("/groups/join/respond", groups.HandleJoinRequestHandler(db))  // Accept/decline a join request
+  protected.HandleFunc("/groups/invite", groups.SendInvitationHandler(db))     // Send a group invitation
+  protected.HandleFunc("/groups/invite/respond", groups.HandleInvitationHandler(db)) // Accept/decline a group invitation
+  protected.HandleFunc("/groups/leave", groups.LeaveGroupHandler(db))          // Leave a group
+  protected.HandleFunc("/groups/user", groups.GetUserGroupsHandler(db))        // Get all groups a user belongs to
+  protected.HandleFunc("/groups/requests", groups.GetPendingRequestsHandler(db))     // Get all pending join requests for a creator's groups
+  protected.HandleFunc("/groups/remove", groups.RemoveMemberHandler(db))       // Remove a member from a group (only for creator)
+  protected.HandleFunc("/groups/delete", groups.DeleteGroupHandler(db))        // Delete a group (only for creator)
+  protected.HandleFunc("/groups/members", groups.GetGroupMembersHandler(db))   // Get a list of all members in a group
 
 
 // Group Posts 
-  mux.HandleFunc("/groups/posts/create", groups.CreateGroupPostHandler(db))       // Create a group post
-  mux.HandleFunc("/groups/posts/delete", groups.DeleteGroupPostHandler(db))       // Delete a group post
-  mux.HandleFunc("/groups/posts", groups.GetGroupPostsHandler(db))                // Fetch all posts in a group
+  protected.Handle("/groups/posts/create", ratelimit.PerUser(contentLimiter, groups.CreateGroupPostHandler(db))) // Create a group post
+  protected.HandleFunc("/groups/posts/delete", groups.DeleteGroupPostHandler(db)) // Delete a group post
+  protected.HandleFunc("/groups/posts", groups.GetGroupPostsHandler(db))          // Fetch all posts in a group
 
 // Group Post Comments
-  mux.HandleFunc("/groups/posts/comments/create", groups.CreateGroupPostCommentHandler(db)) // Add comment to group post
-  mux.HandleFunc("/groups/posts/comments", groups.GetGroupPostCommentsHandler(db))         // Fetch comments for a post
-  mux.HandleFunc("/groups/posts/comments/delete", groups.DeleteGroupPostCommentHandler(db)) // Delete comment
+  protected.Handle("/groups/posts/comments/create", ratelimit.PerUser(contentLimiter, groups.CreateGroupPostCommentHandler(db))) // Add comment to group post
+  protected.HandleFunc("/groups/posts/comments", groups.GetGroupPostCommentsHandler(db))   // Fetch comments for a post
+  protected.HandleFunc("/groups/posts/comments/delete", groups.DeleteGroupPostCommentHandler(db)) // Delete comment
 
   
 // Profile
-  mux.HandleFunc("/users/profile", users.GetUserProfileHandler(db))
-  mux.HandleFunc("/users/profile/update", users.UpdateProfileHandler(db))  
-  mux.HandleFunc("/users/profile/privacy", users.TogglePrivacyHandler(db)) 
+  protected.HandleFunc("/users/profile", users.GetUserProfileHandler(db))
+  protected.HandleFunc("/users/profile/update", users.UpdateProfileHandler(db))  
+  protected.HandleFunc("/users/profile/privacy", users.TogglePrivacyHandler(db)) 
+  protected.HandleFunc("/users/profile/visibility", users.UpdateFieldVisibilityHandler(db))
+  protected.HandleFunc("/users/resolve", users.ResolveNicknameHandler(db))
 
 // Group Events Endpoints
-  mux.HandleFunc("/groups/events/create", events.CreateGroupEventHandler(db))   // Create an event in a group
-  mux.HandleFunc("/groups/events", events.GetGroupEventsHandler(db))            // Fetch events in a group
-  mux.HandleFunc("/groups/events/rsvp", events.RSVPGroupEventHandler(db))       // RSVP to an event
-  mux.HandleFunc("/groups/events/rsvps", events.GetRSVPsForEventHandler(db))    // Fetch RSVPs for an event
-  mux.HandleFunc("/groups/events/rsvp/remove", events.RemoveRSVPHandler(db))    // Remove RSVP
+  protected.HandleFunc("/groups/events/create", events.CreateGroupEventHandler(db))   // Create an event in a group
+  protected.HandleFunc("/groups/events", events.GetGroupEventsHandler(db))      // Fetch events in a group
+  protected.HandleFunc("/groups/events/rsvp", events.RSVPGroupEventHandler(db)) // RSVP to an event
+  protected.HandleFunc("/groups/events/rsvps", events.GetRSVPsForEventHandler(db))    // Fetch RSVPs for an event
+  protected.HandleFunc("/groups/events/rsvp/remove", events.RemoveRSVPHandler(db))    // Remove RSVP
 
 	// Group Chat WebSocket
-mux.HandleFunc("/groups/chat", groups.GroupChatHandler(db))
-mux.HandleFunc("/groups/chat/messages", groups.GetGroupChatMessagesHandler(db))  // Fetch previous messages API
+protected.Handle("/groups/chat", ratelimit.PerIP(socketLimiter, groups.GroupChatHandler(db)))
+protected.HandleFunc("/groups/chat/messages", groups.GetGroupChatMessagesHandler(db))  // Fetch previous messages API
 
 // Private Chat Websocket
-mux.HandleFunc("/chat/private", chat.PrivateChatHandler(db))
-mux.HandleFunc("/chat/history", chat.GetPrivateChatHistoryHandler(db))
-mux.HandleFunc("/markread", chat.MarkMessageReadHandler(db))
+protected.Handle("/chat/private", ratelimit.PerIP(socketLimiter, chat.PrivateChatHandler(db)))
+protected.HandleFunc("/chat/history", chat.GetPrivateChatHistoryHandler(db))
+protected.HandleFunc("/markread", chat.MarkMessageReadHandler(db))
+
+protected.HandleFunc("/ws/online", chat.OnlineUsersSocketHandler(db))
+
 
-mux.HandleFunc("/ws/online", chat.OnlineUsersSocketHandler(db))
+protected.Handle("/search", search.SearchHandler(db))
 
+	// Reporting and moderation
+	protected.Handle("/reports", ratelimit.PerUser(contentLimiter, moderation.CreateReportHandler(db)))
+	protected.Handle("/moderation/reports", auth.RequireRole(staffRoles, moderation.GetReportsHandler(db)))
+	protected.Handle("/moderation/reports/resolve", auth.RequireRole(staffRoles, moderation.ResolveReportHandler(db)))
+	protected.Handle("/moderation/content/hide", auth.RequireRole(staffRoles, moderation.HideContentHandler(db, true)))
+	protected.Handle("/moderation/content/unhide", auth.RequireRole(staffRoles, moderation.HideContentHandler(db, false)))
+	protected.Handle("/moderation/users/suspend", auth.RequireRole(staffRoles, moderation.SuspendUserHandler(db, true)))
+	protected.Handle("/moderation/users/unsuspend", auth.RequireRole(staffRoles, moderation.SuspendUserHandler(db, false)))
+	protected.Handle("/moderation/actions", auth.RequireRole(staffRoles, moderation.GetModerationActionsHandler(db)))
 
-mux.Handle("/search", search.SearchHandler(db))
+	// Admin API
+	protected.Handle("/admin/users", auth.RequireRole(staffRoles, admin.ListUsersHandler(db)))
+	protected.Handle("/admin/users/role", auth.RequireRole(adminRoles, admin.UpdateUserRoleHandler(db)))
+	protected.Handle("/admin/users/suspend", auth.RequireRole(staffRoles, moderation.SuspendUserHandler(db, true)))
+	protected.Handle("/admin/users/unsuspend", auth.RequireRole(staffRoles, moderation.SuspendUserHandler(db, false)))
+	protected.Handle("/admin/users/logout", auth.RequireRole(staffRoles, admin.ForceLogoutHandler(db)))
+	protected.Handle("/admin/content", auth.RequireRole(staffRoles, admin.DeleteContentHandler(db)))
+	protected.Handle("/admin/stats", auth.RequireRole(adminRoles, admin.GetStatsHandler(db)))
 
 
 
 
 
 	// Protected Routes (require authentication)
-	mux.Handle("/protected-resource", auth.AuthMiddleware(db, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	protected.HandleFunc("/protected-resource", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("This is a protected resource"))
-	})))
+	})
+	// The per-user budget and CSRF checks run after authentication, so the session is only resolved
+	// once and a stale session cookie never blocks public routes like /login
+	mux.Handle("/", auth.AuthMiddleware(db, ratelimit.PerUser(userLimiter, auth.CSRFMiddleware(protected))))
 
 	mux.Handle("/uploads/", http.StripPrefix("/uploads/", http.FileServer(http.Dir("uploads"))))
 	mux.Handle("/avatars/", http.StripPrefix("/avatars/", http.FileServer(http.Dir("avatars"))))
 
-		// Apply CORS middleware globally
+		// Apply CORS and the per-IP rate limit globally
 		log.Println("Server is running on http://localhost:8080")
-		log.Fatal(http.ListenAndServe(":8080", CORSMiddleware(mux)))
+		log.Fatal(http.ListenAndServe(":8080", CORSMiddleware(ratelimit.PerIP(ipLimiter, mux))))
 }
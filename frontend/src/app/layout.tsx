@@ -9,6 +9,8 @@ import { Menu, Bell } from "lucide-react";
 import { LeftSidebar } from "@/components/home/leftSideBar";
 import { RightSidebar } from "@/components/Notifications/Sidebar";
 import { ChatSocketProvider } from "@/lib/ChatSocketProvider";
+// Sends the CSRF token with every state-changing axios request
+import "@/lib/csrf";
 
 const geistSans = Geist({ variable: "--font-geist-sans", subsets: ["latin"] });
 const geistMono = Geist_Mono({
@@ -2,6 +2,7 @@
 
 import { useState, useEffect } from "react";
 import axios from "axios";
+import Link from "next/link";
 import Cookies from "js-cookie";
 import { useUserProfile } from "@/lib/hooks/swr/getUserProfile";
 import { Card, CardContent, CardHeader, CardTitle } from "@/components/ui/card";
@@ -32,6 +33,10 @@ export default function SettingsPage() {
   const [avatarFile, setAvatarFile] = useState<File | null>(null);
   const [avatarPreview, setAvatarPreview] = useState(""); // URL for image preview
   const [isPrivate, setIsPrivate] = useState(false);
+  // First page of existing followers to review after going private
+  const [followersToReview, setFollowersToReview] = useState<
+    { id: string; nickname: string; avatar?: string }[]
+  >([]);
   const [message, setMessage] = useState("");
   // New state to track the type of message: "success" or "error"
   const [messageType, setMessageType] = useState<"success" | "error" | "">("");
@@ -118,18 +123,46 @@ export default function SettingsPage() {
     }
   };
 
+  // Remove a follower while reviewing them after going private.
+  const handleRemoveFollower = async (followerId: string) => {
+    try {
+      await axios.delete("http://localhost:8080/followers/remove", {
+        data: { follower_id: followerId },
+        withCredentials: true,
+      });
+      setFollowersToReview((prev) => prev.filter((f) => f.id !== followerId));
+      refreshUser();
+    } catch (err: unknown) {
+      console.log(err);
+      setMessage("Error removing follower.");
+      setMessageType("error");
+    }
+  };
+
   // Handler for toggling privacy.
   const handleTogglePrivacy = async () => {
     setMessage("");
     setMessageType("");
     try {
-      await axios.put(
+      // Going public can let everyone who is waiting in at once
+      const acceptPending =
+        isPrivate && window.confirm("Also accept all pending follow requests?");
+      const { data } = await axios.put(
         "http://localhost:8080/users/profile/privacy",
-        { private: !isPrivate },
+        { private: !isPrivate, accept_pending: acceptPending },
         { withCredentials: true }
       );
       setIsPrivate(!isPrivate);
-      setMessage("Privacy setting updated!");
+      setFollowersToReview(data.private ? data.followers || [] : []);
+      if (data.private && data.followers_to_review > 0) {
+        setMessage(
+          `Privacy setting updated! Your ${data.followers_to_review} existing followers can still see your profile; review them below.`
+        );
+      } else if (data.accepted_requests > 0) {
+        setMessage(`Privacy setting updated! Accepted ${data.accepted_requests} follow requests.`);
+      } else {
+        setMessage("Privacy setting updated!");
+      }
       setMessageType("success");
       refreshUser();
     } catch (err: unknown) {
@@ -235,6 +268,28 @@ export default function SettingsPage() {
               >
                 Switch to {isPrivate ? "Public" : "Private"} Account
               </Button>
+
+              {followersToReview.length > 0 && (
+                <div className="mt-4">
+                  <h3 className="font-semibold mb-2">Review your followers</h3>
+                  <ul className="space-y-2">
+                    {followersToReview.map((follower) => (
+                      <li key={follower.id} className="flex items-center justify-between">
+                        <span>{follower.nickname}</span>
+                        <Button
+                          variant="outline"
+                          onClick={() => handleRemoveFollower(follower.id)}
+                        >
+                          Remove
+                        </Button>
+                      </li>
+                    ))}
+                  </ul>
+                  <Link href={`/profile/${userId}`} className="text-[#6C5CE7] underline mt-2 inline-block">
+                    See all followers
+                  </Link>
+                </div>
+              )}
             </div>
 
             {message && (
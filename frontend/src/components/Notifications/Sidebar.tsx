@@ -5,6 +5,7 @@ import { Button } from "@/components/ui/button";
 import { Bell, X, UserCheck, UserX } from "lucide-react";
 import { Avatar, AvatarImage } from "@/components/ui/avatar";
 import Cookies from "js-cookie";
+import { csrfHeaders } from "@/lib/csrf";
 
 interface Notification {
   id: string;
@@ -80,6 +81,7 @@ export function RightSidebar({ isOpen, onClose }: RightSidebarProps) {
         {
           method: "PUT",
           credentials: "include",
+          headers: csrfHeaders(),
         }
       );
       if (res.ok) {
@@ -103,7 +105,7 @@ export function RightSidebar({ isOpen, onClose }: RightSidebarProps) {
       const res = await fetch("http://localhost:8080/follow/request", {
         method: "PUT",
         credentials: "include",
-        headers: { "Content-Type": "application/json" },
+        headers: { "Content-Type": "application/json", ...csrfHeaders() },
         body: JSON.stringify({
           follower_id: notification.related_user_id, // requester's ID
           action,
@@ -151,7 +153,7 @@ export function RightSidebar({ isOpen, onClose }: RightSidebarProps) {
       const res = await fetch(endpoint, {
         method: "PUT",
         credentials: "include",
-        headers: { "Content-Type": "application/json" },
+        headers: { "Content-Type": "application/json", ...csrfHeaders() },
         body: JSON.stringify(payload),
       });
       if (res.ok) {
@@ -172,6 +174,7 @@ export function RightSidebar({ isOpen, onClose }: RightSidebarProps) {
       const res = await fetch("http://localhost:8080/notifications/read-all", {
         method: "PUT",
         credentials: "include",
+        headers: csrfHeaders(),
       });
       if (res.ok) {
         setNotifications((prev) => prev.map((n) => ({ ...n, read: true })));
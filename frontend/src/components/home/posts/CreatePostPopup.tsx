@@ -20,8 +20,12 @@ import { Label } from "@/components/ui/label";
 import { Image, Globe, Lock, Users, User } from "lucide-react";
 import { useFollowers } from "@/lib/hooks/swr/useFollowers";
 import Cookies from "js-cookie";
+import { csrfHeaders } from "@/lib/csrf";
 import Alert from "@/components/ui/alert";
 
+// How many followers the audience picker shows at a time
+const FOLLOWERS_PAGE_SIZE = 20;
+
 interface CreatePostPopupProps {
   isOpen: boolean;
   onClose: () => void;
@@ -57,10 +61,13 @@ export function CreatePostPopup({
   } | null>(null);
   const maxChars = 500; // Maximum allowed characters
 
-  // Get logged-in user's ID from cookies and fetch real followers
+  // Get logged-in user's ID from cookies and fetch real followers, a page at a time
   const loggedInUserId = Cookies.get("user_id") || "";
-  const { followers, isLoading: followersLoading } =
-    useFollowers(loggedInUserId);
+  const [followersQuery, setFollowersQuery] = useState("");
+  const [followersPage, setFollowersPage] = useState(1);
+  const { followers, total: followersTotal, isLoading: followersLoading } =
+    useFollowers(loggedInUserId, followersPage, followersQuery, FOLLOWERS_PAGE_SIZE);
+  const followersLastPage = Math.max(1, Math.ceil(followersTotal / FOLLOWERS_PAGE_SIZE));
 
   const handleImageChange = (e: React.ChangeEvent<HTMLInputElement>) => {
     if (e.target.files && e.target.files[0]) {
@@ -101,6 +108,7 @@ export function CreatePostPopup({
         method: "POST",
         body: formData,
         credentials: "include",
+        headers: csrfHeaders(),
       });
 
       if (!response.ok) {
@@ -117,6 +125,8 @@ export function CreatePostPopup({
       setContent("");
       setPrivacy("public");
       setSelectedUsers([]);
+      setFollowersQuery("");
+      setFollowersPage(1);
       setImage(null);
       onClose();
     } catch (error) {
@@ -212,6 +222,35 @@ export function CreatePostPopup({
                 <Label className="mb-2 block font-medium">
                   Select users who can see this post:
                 </Label>
+                <div className="flex items-center gap-2 mb-2">
+                  <Input
+                    placeholder="Search followers by nickname"
+                    value={followersQuery}
+                    onChange={(e) => {
+                      setFollowersQuery(e.target.value);
+                      setFollowersPage(1);
+                    }}
+                  />
+                  <Button
+                    variant="outline"
+                    disabled={followersPage <= 1}
+                    onClick={() => setFollowersPage(followersPage - 1)}
+                  >
+                    Previous
+                  </Button>
+                  <Button
+                    variant="outline"
+                    disabled={followersPage >= followersLastPage}
+                    onClick={() => setFollowersPage(followersPage + 1)}
+                  >
+                    Next
+                  </Button>
+                </div>
+                {selectedUsers.length > 0 && (
+                  <p className="text-sm text-gray-500 mb-2">
+                    {selectedUsers.length} selected
+                  </p>
+                )}
                 {followersLoading ? (
                   <p>Loading followers...</p>
                 ) : (
@@ -247,7 +286,11 @@ export function CreatePostPopup({
                         </div>
                       ))
                     ) : (
-                      <p>No followers available</p>
+                      <p>
+                        {followersQuery
+                          ? "No followers match your search"
+                          : "No followers available"}
+                      </p>
                     )}
                   </div>
                 )}
@@ -5,14 +5,11 @@ import PostsList from "../home/posts/postList";
 import { useState } from "react";
 import { Post } from "@/types/post";
 import { PostView } from "@/components/home/posts/postView";
+import { Input } from "@/components/ui/input";
+import { Button } from "@/components/ui/button";
+import { useFollowers, useFollowing } from "@/lib/hooks/swr/useFollowers";
 
-interface Follower {
-  id: string;
-  nickname: string;
-  avatar?: string; // Can be undefined
-}
-
-interface Following {
+interface FollowUser {
   id: string;
   nickname: string;
   avatar?: string; // Can be undefined
@@ -21,8 +18,107 @@ interface Following {
 interface User {
   id: string;
   posts: Post[] | null;
-  followers: Follower[] | null;
-  following: Following[] | null;
+}
+
+const PAGE_SIZE = 20;
+
+interface ListControlsProps {
+  query: string;
+  onQueryChange: (query: string) => void;
+  page: number;
+  total: number;
+  onPageChange: (page: number) => void;
+}
+
+function ListControls({ query, onQueryChange, page, total, onPageChange }: ListControlsProps) {
+  const lastPage = Math.max(1, Math.ceil(total / PAGE_SIZE));
+  return (
+    <div className="flex items-center gap-2 mb-4">
+      <Input
+        placeholder="Search by nickname"
+        value={query}
+        onChange={(e) => onQueryChange(e.target.value)}
+      />
+      <Button variant="outline" disabled={page <= 1} onClick={() => onPageChange(page - 1)}>
+        Previous
+      </Button>
+      <Button variant="outline" disabled={page >= lastPage} onClick={() => onPageChange(page + 1)}>
+        Next
+      </Button>
+    </div>
+  );
+}
+
+function FollowersList({ userId }: { userId: string }) {
+  const [query, setQuery] = useState("");
+  const [page, setPage] = useState(1);
+  const { followers, total, isLoading } = useFollowers(userId, page, query, PAGE_SIZE);
+
+  return (
+    <>
+      <ListControls
+        query={query}
+        onQueryChange={(q) => {
+          setQuery(q);
+          setPage(1);
+        }}
+        page={page}
+        total={total}
+        onPageChange={setPage}
+      />
+      {isLoading ? (
+        <p className="text-center text-gray-500">Loading followers...</p>
+      ) : followers && followers.length > 0 ? (
+        followers.map((follower: FollowUser) => (
+          <FollowerItem
+            key={follower.id}
+            follower={{
+              ...follower,
+              avatar: follower.avatar ?? "/profile.png", // Ensure avatar is always a string
+            }}
+          />
+        ))
+      ) : (
+        <p className="text-center text-gray-500">No followers yet.</p>
+      )}
+    </>
+  );
+}
+
+function FollowingList({ userId }: { userId: string }) {
+  const [query, setQuery] = useState("");
+  const [page, setPage] = useState(1);
+  const { following, total, isLoading } = useFollowing(userId, page, query, PAGE_SIZE);
+
+  return (
+    <>
+      <ListControls
+        query={query}
+        onQueryChange={(q) => {
+          setQuery(q);
+          setPage(1);
+        }}
+        page={page}
+        total={total}
+        onPageChange={setPage}
+      />
+      {isLoading ? (
+        <p className="text-center text-gray-500">Loading following...</p>
+      ) : following && following.length > 0 ? (
+        following.map((followed: FollowUser) => (
+          <FollowingItem
+            key={followed.id}
+            following={{
+              ...followed,
+              avatar: followed.avatar ?? "/profile.png", // Ensure avatar is always a string
+            }}
+          />
+        ))
+      ) : (
+        <p className="text-center text-gray-500">Not following anyone yet.</p>
+      )}
+    </>
+  );
 }
 
 interface ProfileTabsProps {
@@ -58,45 +154,11 @@ export default function ProfileTabs({ user }: ProfileTabsProps) {
       </TabsContent>
 
       <TabsContent value="followers">
-        {user.followers !== null && user.followers.length > 0 ? (
-          user.followers
-            .filter(
-              (follower, index, self) =>
-                self.findIndex((f) => f.id === follower.id) === index
-            )
-            .map((follower, index) => (
-              <FollowerItem
-                key={`${follower.id}-${index}`}
-                follower={{
-                  ...follower,
-                  avatar: follower.avatar ?? "/profile.png", // Ensure avatar is always a string
-                }}
-              />
-            ))
-        ) : (
-          <p className="text-center text-gray-500">No followers yet.</p>
-        )}
+        <FollowersList userId={user.id} />
       </TabsContent>
 
       <TabsContent value="following">
-        {user.following !== null && user.following.length > 0 ? (
-          user.following
-            .filter(
-              (following, index, self) =>
-                self.findIndex((f) => f.id === following.id) === index
-            )
-            .map((following, index) => (
-              <FollowingItem
-                key={`${following.id}-${index}`}
-                following={{
-                  ...following,
-                  avatar: following.avatar ?? "/profile.png", // Ensure avatar is always a string
-                }}
-              />
-            ))
-        ) : (
-          <p className="text-center text-gray-500">Not following anyone yet.</p>
-        )}
+        <FollowingList userId={user.id} />
       </TabsContent>
     </Tabs>
   );
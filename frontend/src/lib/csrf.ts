@@ -0,0 +1,25 @@
+import axios from "axios";
+import Cookies from "js-cookie";
+
+// The backend rejects cookie-authenticated POST, PUT and DELETE requests unless they repeat
+// the csrf_token cookie in the X-CSRF-Token header.
+export const CSRF_HEADER = "X-CSRF-Token";
+
+const SAFE_METHODS = ["get", "head", "options"];
+
+// Headers to add to a state-changing fetch() call
+export function csrfHeaders(): Record<string, string> {
+  const token = Cookies.get("csrf_token");
+  return token ? { [CSRF_HEADER]: token } : {};
+}
+
+axios.defaults.withCredentials = true;
+
+axios.interceptors.request.use((config) => {
+  const method = (config.method || "get").toLowerCase();
+  const token = Cookies.get("csrf_token");
+  if (token && !SAFE_METHODS.includes(method)) {
+    config.headers.set(CSRF_HEADER, token);
+  }
+  return config;
+});
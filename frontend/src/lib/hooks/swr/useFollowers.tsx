@@ -1,17 +1,37 @@
 import useSWR from "swr";
 import { fetcher } from "@/lib/hooks/swr/fetcher";
 
-export function useFollowers(userId?: string) {
+function followsUrl(
+  list: "followers" | "following",
+  userId?: string,
+  page = 1,
+  query = "",
+  limit = 20
+) {
+  const params = new URLSearchParams({ page: String(page), limit: String(limit) });
   // If userId is provided, use it; otherwise, rely on the session's logged-in user.
-  const { data, error } = useSWR(
-    userId
-      ? `http://localhost:8080/followers?user_id=${userId}`
-      : `http://localhost:8080/followers`,
-    fetcher
-  );
+  if (userId) params.set("user_id", userId);
+  if (query) params.set("query", query);
+  return `http://localhost:8080/${list}?${params.toString()}`;
+}
+
+export function useFollowers(userId?: string, page = 1, query = "", limit = 20) {
+  const { data, error } = useSWR(followsUrl("followers", userId, page, query, limit), fetcher);
+
+  return {
+    followers: data?.followers, // Array of follower objects: { id, nickname, avatar }
+    total: data?.total ?? 0,
+    isLoading: !error && !data,
+    isError: !!error,
+  };
+}
+
+export function useFollowing(userId?: string, page = 1, query = "", limit = 20) {
+  const { data, error } = useSWR(followsUrl("following", userId, page, query, limit), fetcher);
 
   return {
-    followers: data, // Array of follower objects: { id, nickname, avatar }
+    following: data?.following, // Array of followed user objects: { id, nickname, avatar }
+    total: data?.total ?? 0,
     isLoading: !error && !data,
     isError: !!error,
   };